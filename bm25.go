@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// BM25 is an inverted index scoring lenses with Okapi BM25. Document
+// frequencies are kept by the embedded TfIdf counter; each Add is one
+// document.
+type BM25 struct {
+	TfIdf
+	K1, B    float64
+	postings map[string]map[uint32]int
+	lengths  map[uint32]int
+	total    int
+}
+
+func (bm *BM25) Add(id uint32, terms []string) {
+	if bm.postings == nil {
+		bm.postings = make(map[string]map[uint32]int, 1024)
+		bm.lengths = make(map[uint32]int, 1024)
+	}
+	for _, t := range terms {
+		bm.Inc(t)
+		if bm.postings[t] == nil {
+			bm.postings[t] = make(map[uint32]int, 8)
+		}
+		bm.postings[t][id]++
+	}
+	bm.Doc()
+	bm.lengths[id] = len(terms)
+	bm.total += len(terms)
+}
+
+// Score returns the BM25 score of every document matching any of terms.
+func (bm *BM25) Score(terms []string) (scores map[uint32]float64) {
+	scores = make(map[uint32]float64)
+	if bm.docs == 0 {
+		return
+	}
+	k1, b := bm.K1, bm.B
+	if k1 <= 0 {
+		k1 = 1.2
+	}
+	if b <= 0 || b > 1 {
+		b = 0.75
+	}
+	n := float64(bm.docs)
+	avgdl := float64(bm.total) / n
+	seen := make(map[string]struct{}, len(terms))
+	for _, t := range terms {
+		if _, ok := seen[t]; ok {
+			continue
+		}
+		seen[t] = struct{}{}
+		df := float64(bm.df[t])
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for id, tf := range bm.postings[t] {
+			x, dl := float64(tf), float64(bm.lengths[id])
+			scores[id] += idf * x * (k1 + 1) / (x + k1*(1-b+b*dl/avgdl))
+		}
+	}
+	return
+}
+
+// Mode selects how Index.Search ranks lenses.
+type Mode string
+
+const (
+	Semantic Mode = "semantic"
+	Lexical  Mode = "lexical"
+	Hybrid   Mode = "hybrid"
+)
+
+func (mode Mode) Valid() error {
+	switch mode {
+	case Semantic, Lexical, Hybrid:
+		return nil
+	}
+	return fmt.Errorf("retrieval mode %q not recognized", string(mode))
+}
+
+// Retrieval configures Index.Search. In hybrid mode the semantic and lexical
+// rankings are combined either by reciprocal-rank fusion, or, if Weighted is
+// set, by Alpha times the cosine similarity plus 1-Alpha times the BM25
+// score relative to the best match. Approx ranks semantically through the
+// HNSW graph, which only returns the K nearest lenses, rather than by
+// comparing against every lens. A positive Rerank has the REPL and server go
+// on to Pinpoint single messages within that many of the best lenses, scoring
+// them by RerankAlpha the way Alpha weighs a weighted hybrid ranking.
+type Retrieval struct {
+	Mode        Mode
+	Weighted    bool
+	Alpha       float64
+	Approx      bool
+	K           int
+	Rerank      int
+	RerankAlpha float64
+	Around      int
+}
+
+func (index *Index) semantic(cfg Retrieval, q string, filters []Filter) []Result {
+	if cfg.Approx {
+		return index.Query(q, cfg.K, filters...)
+	}
+	return index.QueryBrute(q, filters...)
+}
+
+// rrfK damps the contribution of the top ranks in reciprocal-rank fusion.
+const rrfK = 60
+
+// terms extracts the literal tokens of a lens for the lexical index.
+func (lens *Lens) terms() []string {
+	lexer := Collector{Sanitizer: SanitizerChain{StripPunct, ToLower}}
+	for _, msg := range lens.Messages {
+		IndexPolicy.Lex(&lexer, msg.Content)
+	}
+	return lexer.Tokens
+}
+
+func (index *Index) queryLexical(q string, filters []Filter) (results []Result) {
+	lexer := Collector{Sanitizer: SanitizerChain{StripPunct, ToLower}}
+	IndexPolicy.Lex(&lexer, q)
+	index.RLock()
+	defer index.RUnlock()
+	for id, score := range index.lexicon.Score(lexer.Tokens) {
+		if lens := index.qledger[id]; admits(filters, lens) {
+			results = append(results, Result{lens, float32(score)})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Distance > results[j].Distance
+	})
+	return
+}
+
+// Search ranks the lenses admitted by filters against q as configured by
+// index.Retrieval.
+func (index *Index) Search(q string, filters ...Filter) []Result {
+	return index.SearchWith(index.Retrieval, q, filters...)
+}
+
+// SearchWith ranks the lenses admitted by filters against q as configured by
+// cfg. Results are ordered best first; their Distance is the score under the
+// chosen mode, higher being better.
+func (index *Index) SearchWith(cfg Retrieval, q string, filters ...Filter) (results []Result) {
+	switch cfg.Mode {
+	case Lexical:
+		return index.queryLexical(q, filters)
+	case Semantic, "":
+		return index.semantic(cfg, q, filters)
+	}
+	semantic := index.semantic(cfg, q, filters)
+	lexical := index.queryLexical(q, filters)
+	fused := make(map[*Lens]float64, len(semantic))
+	if cfg.Weighted {
+		alpha := cfg.Alpha
+		for _, r := range semantic {
+			if !math.IsNaN(float64(r.Distance)) {
+				fused[r.Lens] += alpha * float64(r.Distance)
+			}
+		}
+		if len(lexical) > 0 {
+			best := float64(lexical[0].Distance)
+			for _, r := range lexical {
+				fused[r.Lens] += (1 - alpha) * float64(r.Distance) / best
+			}
+		}
+	} else {
+		for rank, r := range semantic {
+			if !math.IsNaN(float64(r.Distance)) {
+				fused[r.Lens] += 1 / float64(rrfK+rank+1)
+			}
+		}
+		for rank, r := range lexical {
+			fused[r.Lens] += 1 / float64(rrfK+rank+1)
+		}
+	}
+	results = make([]Result, 0, len(fused))
+	for lens, score := range fused {
+		results = append(results, Result{lens, float32(score)})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Distance > results[j].Distance
+	})
+	return
+}
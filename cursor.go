@@ -0,0 +1,131 @@
+package main
+
+import (
+	"io"
+
+	dgo "github.com/bwmarrin/discordgo"
+)
+
+// Cursor records the span of a channel's history that the index covers.
+// Exhausted is set once a backward crawl has reached the first message.
+// LiveOldest and LiveNewest span the messages indexed from the gateway past
+// Newest; those between Newest and LiveOldest are yet to be crawled.
+type Cursor struct {
+	Oldest, Newest         string
+	Exhausted              bool
+	LiveOldest, LiveNewest string
+}
+
+// Cover widens the cursor to include the given span of message IDs. Once it
+// reaches the live span, it takes that in too.
+func (cur *Cursor) Cover(oldest, newest string) {
+	if cur.Oldest == "" || snowflakeLess(oldest, cur.Oldest) {
+		cur.Oldest = oldest
+	}
+	if snowflakeLess(cur.Newest, newest) {
+		cur.Newest = newest
+	}
+	if cur.LiveOldest != "" && !snowflakeLess(cur.Newest, cur.LiveOldest) {
+		if snowflakeLess(cur.Newest, cur.LiveNewest) {
+			cur.Newest = cur.LiveNewest
+		}
+		cur.LiveOldest, cur.LiveNewest = "", ""
+	}
+}
+
+// CoverLive widens the live span to include the given one. A channel that
+// has not been crawled has no gap to leave.
+func (cur *Cursor) CoverLive(oldest, newest string) {
+	if cur.Newest == "" {
+		cur.Cover(oldest, newest)
+		return
+	}
+	if cur.LiveOldest == "" || snowflakeLess(oldest, cur.LiveOldest) {
+		cur.LiveOldest = oldest
+	}
+	if snowflakeLess(cur.LiveNewest, newest) {
+		cur.LiveNewest = newest
+	}
+}
+
+// snowflakeLess orders decimal snowflakes numerically without parsing them.
+func snowflakeLess(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+// Walk pages through a channel's history starting from, and excluding, the
+// Anchor message, or from the newest one if Anchor is empty. A forward walk
+// yields newer messages oldest-first; a backward walk yields older messages
+// newest-first. Pages are buffered so that a window may end anywhere in
+// one. A forward walk that reaches SkipFrom jumps past SkipTo, the span
+// indexed live.
+type Walk struct {
+	Session          *dgo.Session
+	ChID             string
+	Anchor           string
+	SkipFrom, SkipTo string
+	Forward          bool
+	buf              []*dgo.Message
+	cursor           string
+}
+
+func (w *Walk) page() (err error) {
+	s := w.Session
+	var page []*dgo.Message
+	if w.Forward {
+		page, err = s.ChannelMessages(w.ChID, 100, "", w.Anchor, "")
+		// the API returns the page newest-first either way
+		for i, j := 0, len(page)-1; i < j; i, j = i+1, j-1 {
+			page[i], page[j] = page[j], page[i]
+		}
+	} else {
+		page, err = s.ChannelMessages(w.ChID, 100, w.Anchor, "", "")
+	}
+	if err != nil {
+		return
+	}
+	if len(page) == 0 {
+		return io.EOF
+	}
+	w.Anchor = page[len(page)-1].ID
+	if w.Forward && w.SkipFrom != "" {
+		for i, msg := range page {
+			if !snowflakeLess(msg.ID, w.SkipFrom) {
+				page, w.Anchor, w.SkipFrom = page[:i], w.SkipTo, ""
+				break
+			}
+		}
+		if len(page) == 0 {
+			return w.page()
+		}
+	}
+	w.buf = page
+	return
+}
+
+func (w *Walk) Unroll(fn func(*dgo.Message) bool) (err error) {
+	for {
+		if len(w.buf) == 0 {
+			if err = w.page(); err != nil {
+				return
+			}
+		}
+		msg := w.buf[0]
+		w.buf = w.buf[1:]
+		w.cursor = msg.ID
+		if !fn(msg) {
+			return
+		}
+	}
+}
+
+func (w *Walk) Unread(msgs ...*dgo.Message) {
+	w.buf = append(msgs[:len(msgs):len(msgs)], w.buf...)
+}
+
+func (w *Walk) Cursor() string {
+	return w.cursor
+}
@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestCursorLive(t *testing.T) {
+	var cur Cursor
+	cur.Cover("10", "20")
+	cur.CoverLive("50", "60")
+	if cur.Newest != "20" || cur.LiveOldest != "50" || cur.LiveNewest != "60" {
+		t.Fatalf("live span moved the crawl cursor: %+v", cur)
+	}
+	cur.Cover("21", "30")
+	if cur.Newest != "30" || cur.LiveOldest != "50" {
+		t.Fatalf("crawl short of the live span: %+v", cur)
+	}
+	cur.Cover("31", "55")
+	if cur.Newest != "60" || cur.LiveOldest != "" || cur.LiveNewest != "" {
+		t.Fatalf("crawl into the live span: %+v", cur)
+	}
+	var fresh Cursor
+	fresh.CoverLive("50", "60")
+	if fresh.Oldest != "50" || fresh.Newest != "60" {
+		t.Fatalf("live span of an uncrawled channel: %+v", fresh)
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	dgo "github.com/bwmarrin/discordgo"
+)
+
+// Replay yields a fixed list of messages in order and then io.EOF. It serves
+// both exports read into memory and fixtures.
+type Replay struct {
+	Messages []*dgo.Message
+	next     int
+}
+
+func (r *Replay) Unroll(fn func(*dgo.Message) bool) error {
+	for r.next < len(r.Messages) {
+		msg := r.Messages[r.next]
+		r.next++
+		if !fn(msg) {
+			return nil
+		}
+	}
+	return io.EOF
+}
+
+// Unread steps back over msgs, which must be the last ones yielded.
+func (r *Replay) Unread(msgs ...*dgo.Message) {
+	r.next -= len(msgs)
+}
+
+func (r *Replay) Cursor() string {
+	if r.next == 0 {
+		return ""
+	}
+	return r.Messages[r.next-1].ID
+}
+
+// Export is the history of one channel read from disk.
+type Export struct {
+	Origin
+	Messages []*dgo.Message
+}
+
+// Feed replays the export newest message first, like a backward crawl.
+func (e Export) Feed() Feed {
+	return Feed{e.Origin, &Replay{Messages: e.Messages}}
+}
+
+// newestFirst orders the export's messages the way a backward crawl yields
+// them.
+func (e *Export) newestFirst() {
+	sort.Slice(e.Messages, func(i, j int) bool {
+		return snowflakeLess(e.Messages[j].ID, e.Messages[i].ID)
+	})
+}
+
+// flexID decodes a snowflake given either as a JSON string or a number.
+type flexID string
+
+func (id *flexID) UnmarshalJSON(b []byte) error {
+	*id = flexID(strings.Trim(string(b), `"`))
+	return nil
+}
+
+func readJSON(path string, v interface{}) (err error) {
+	istrm, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer istrm.Close()
+	if err = json.NewDecoder(istrm).Decode(v); err != nil {
+		err = fmt.Errorf("%s: %s", path, err)
+	}
+	return
+}
+
+// packageChannel is channel.json in a "Request my data" package.
+type packageChannel struct {
+	ID    flexID `json:"id"`
+	Name  string `json:"name"`
+	Guild *struct {
+		ID   flexID `json:"id"`
+		Name string `json:"name"`
+	} `json:"guild"`
+}
+
+// packageMessage is one entry of messages.json; messages.csv has the same
+// columns.
+type packageMessage struct {
+	ID       flexID `json:"ID"`
+	Contents string `json:"Contents"`
+}
+
+func readPackageCSV(path string) (msgs []packageMessage, err error) {
+	istrm, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer istrm.Close()
+	rd := csv.NewReader(istrm)
+	rd.LazyQuotes = true
+	rd.FieldsPerRecord = -1
+	header, err := rd.Read()
+	if err != nil {
+		if err == io.EOF {
+			err = nil
+		}
+		return
+	}
+	id, contents := -1, -1
+	for i, col := range header {
+		switch strings.TrimSpace(col) {
+		case "ID":
+			id = i
+		case "Contents":
+			contents = i
+		}
+	}
+	if id < 0 || contents < 0 {
+		err = fmt.Errorf("%s: missing ID or Contents column", path)
+		return
+	}
+	for {
+		var record []string
+		if record, err = rd.Read(); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+		if len(record) <= id || len(record) <= contents {
+			continue
+		}
+		msgs = append(msgs, packageMessage{flexID(record[id]), record[contents]})
+	}
+}
+
+// ReadPackage reads the messages/ directory of a Discord data package. Every
+// message in a package was sent by its owner, who is read from
+// account/user.json when present.
+func ReadPackage(root string) (exports []Export, err error) {
+	var owner struct {
+		ID            flexID `json:"id"`
+		Username      string `json:"username"`
+		Discriminator string `json:"discriminator"`
+	}
+	if err = readJSON(filepath.Join(root, "account", "user.json"), &owner); os.IsNotExist(err) {
+		err = nil
+	} else if err != nil {
+		return
+	}
+	author := &dgo.User{
+		ID:            string(owner.ID),
+		Username:      owner.Username,
+		Discriminator: owner.Discriminator,
+	}
+	names := map[string]string{}
+	if err = readJSON(filepath.Join(root, "messages", "index.json"), &names); err != nil && !os.IsNotExist(err) {
+		return
+	}
+	dirs, err := ioutil.ReadDir(filepath.Join(root, "messages"))
+	if err != nil {
+		return
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		path := filepath.Join(root, "messages", dir.Name())
+		var ch packageChannel
+		if err = readJSON(filepath.Join(path, "channel.json"), &ch); err != nil && !os.IsNotExist(err) {
+			return
+		}
+		chID := string(ch.ID)
+		if chID == "" {
+			// older packages name the directory after the bare channel ID
+			chID = strings.TrimPrefix(dir.Name(), "c")
+		}
+		origin := Origin{ChID: chID}
+		if ch.Guild != nil {
+			origin.GuildID, origin.Guild, origin.Name = string(ch.Guild.ID), ch.Guild.Name, ch.Name
+		} else if name := names[chID]; name != "" {
+			origin.Recipients = []string{strings.TrimPrefix(name, "Direct Message with ")}
+		}
+		var msgs []packageMessage
+		if err = readJSON(filepath.Join(path, "messages.json"), &msgs); os.IsNotExist(err) {
+			msgs, err = readPackageCSV(filepath.Join(path, "messages.csv"))
+		}
+		if err != nil {
+			return
+		}
+		export := Export{Origin: origin, Messages: make([]*dgo.Message, 0, len(msgs))}
+		for _, msg := range msgs {
+			export.Messages = append(export.Messages, &dgo.Message{
+				ID:        string(msg.ID),
+				ChannelID: chID,
+				GuildID:   origin.GuildID,
+				Content:   msg.Contents,
+				Author:    author,
+			})
+		}
+		export.newestFirst()
+		exports = append(exports, export)
+	}
+	return
+}
+
+// chatExport is the JSON written by DiscordChatExporter.
+type chatExport struct {
+	Guild struct {
+		ID   flexID `json:"id"`
+		Name string `json:"name"`
+	} `json:"guild"`
+	Channel struct {
+		ID   flexID `json:"id"`
+		Type string `json:"type"`
+		Name string `json:"name"`
+	} `json:"channel"`
+	Messages []struct {
+		ID      flexID `json:"id"`
+		Content string `json:"content"`
+		Author  struct {
+			ID            flexID `json:"id"`
+			Name          string `json:"name"`
+			Discriminator string `json:"discriminator"`
+		} `json:"author"`
+	} `json:"messages"`
+}
+
+// ReadChatExport reads one channel exported by DiscordChatExporter.
+func ReadChatExport(path string) (export Export, err error) {
+	var dump chatExport
+	if err = readJSON(path, &dump); err != nil {
+		return
+	}
+	chID := string(dump.Channel.ID)
+	export.Origin = Origin{ChID: chID}
+	direct := strings.HasPrefix(dump.Channel.Type, "Direct")
+	if !direct {
+		export.GuildID, export.Guild, export.Name = string(dump.Guild.ID), dump.Guild.Name, dump.Channel.Name
+	}
+	authors := make(map[string]*dgo.User)
+	for _, msg := range dump.Messages {
+		id := string(msg.Author.ID)
+		author, ok := authors[id]
+		if !ok {
+			author = &dgo.User{
+				ID:            id,
+				Username:      msg.Author.Name,
+				Discriminator: msg.Author.Discriminator,
+			}
+			authors[id] = author
+			if direct {
+				export.Recipients = append(export.Recipients, author.String())
+			}
+		}
+		export.Messages = append(export.Messages, &dgo.Message{
+			ID:        string(msg.ID),
+			ChannelID: chID,
+			GuildID:   export.GuildID,
+			Content:   msg.Content,
+			Author:    author,
+		})
+	}
+	export.newestFirst()
+	return
+}
+
+// importJSONL streams a single-channel JSONL message log.
+func importJSONL(path string) (feed Feed, err error) {
+	src, err := OpenJSONL(path, "")
+	if err != nil {
+		return
+	}
+	msg, err := src.Peek()
+	if err != nil {
+		src.Close()
+		return
+	}
+	return Feed{Origin{ChID: msg.ChannelID}, src}, nil
+}
+
+// Import reads a data package directory, a DiscordChatExporter JSON file, a
+// JSONL message log of one channel, or a directory of the last two.
+func Import(path string) (feeds []Feed, err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	if !info.IsDir() {
+		var feed Feed
+		if filepath.Ext(path) == ".jsonl" {
+			feed, err = importJSONL(path)
+		} else {
+			var export Export
+			export, err = ReadChatExport(path)
+			feed = export.Feed()
+		}
+		if err != nil {
+			return
+		}
+		return []Feed{feed}, nil
+	}
+	if _, err = os.Stat(filepath.Join(path, "messages")); err == nil {
+		var exports []Export
+		if exports, err = ReadPackage(path); err != nil {
+			return
+		}
+		for _, export := range exports {
+			feeds = append(feeds, export.Feed())
+		}
+		return
+	}
+	for _, pattern := range []string{"*.json", "*.jsonl"} {
+		var matches []string
+		if matches, err = filepath.Glob(filepath.Join(path, pattern)); err != nil {
+			return
+		}
+		for _, match := range matches {
+			var feed []Feed
+			if feed, err = Import(match); err != nil {
+				return
+			}
+			feeds = append(feeds, feed...)
+		}
+	}
+	return
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestReplaySearch indexes a fixture channel end to end and searches it.
+func TestReplaySearch(t *testing.T) {
+	index := &Index{Vocab: testVocab()}
+	feed := Feed{Origin{ChID: "1"}, &Replay{Messages: testMessages("1", 1,
+		"my cat and my dog", "the dog chased the pet cat",
+		"rain all day", "sunny tomorrow then cloudy and rain")}}
+	for {
+		_, err := index.Hydrate(feed, 4)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(index.qledger) != 2 {
+		t.Fatalf("%d lenses, want 2", len(index.qledger))
+	}
+	for _, mode := range []Mode{Semantic, Lexical, Hybrid} {
+		results := index.SearchWith(Retrieval{Mode: mode}, "rain")
+		if len(results) == 0 {
+			t.Errorf("%s: no results", mode)
+			continue
+		}
+		if got := results[0].Messages[0].Content; got != "rain all day" {
+			t.Errorf("%s: best window starts %q", mode, got)
+		}
+	}
+}
+
+// exportSummary flattens an export's messages to "id author: content".
+func exportSummary(export Export) (msgs []string) {
+	for _, msg := range export.Messages {
+		msgs = append(msgs, fmt.Sprintf("%s %s: %s", msg.ID, msg.Author, msg.Content))
+	}
+	return
+}
+
+func TestReadPackage(t *testing.T) {
+	exports, err := ReadPackage(filepath.Join("testdata", "package"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Export{
+		{Origin{ChID: "333"}, nil},
+		{Origin{ChID: "111", Recipients: []string{"bob#0002"}}, nil},
+		{Origin{ChID: "222", GuildID: "999", Guild: "Home", Name: "general"}, nil},
+	}
+	msgs := [][]string{
+		{"700000000000000020 ann#0001: pet"},
+		{"700000000000000003 ann#0001: rain\nall day", "700000000000000002 ann#0001: cloudy",
+			"700000000000000001 ann#0001: is it sunny, then?"},
+		{"700000000000000012 ann#0001: dog", "700000000000000010 ann#0001: cat"},
+	}
+	if len(exports) != len(want) {
+		t.Fatalf("read %d channels, want %d", len(exports), len(want))
+	}
+	for i, export := range exports {
+		if !reflect.DeepEqual(export.Origin, want[i].Origin) {
+			t.Errorf("channel %d: %+v, want %+v", i, export.Origin, want[i].Origin)
+		}
+		if got := exportSummary(export); !reflect.DeepEqual(got, msgs[i]) {
+			t.Errorf("channel %s: %q, want %q", export.ChID, got, msgs[i])
+		}
+	}
+}
+
+func TestReadChatExport(t *testing.T) {
+	for _, tc := range []struct {
+		file   string
+		origin Origin
+		msgs   []string
+	}{
+		{"dm.json", Origin{ChID: "444", Recipients: []string{"bob#0002", "ann#0001"}}, []string{
+			"700000000000000032 bob#0002: pet", "700000000000000031 ann#0001: dog!", "700000000000000030 bob#0002: cat?"}},
+		{"guild.json", Origin{ChID: "555", GuildID: "999", Guild: "Home", Name: "weather"}, []string{
+			"700000000000000041 cy#0003: sunny", "700000000000000040 ann#0001: rain"}},
+	} {
+		export, err := ReadChatExport(filepath.Join("testdata", "chatexport", tc.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(export.Origin, tc.origin) {
+			t.Errorf("%s: %+v, want %+v", tc.file, export.Origin, tc.origin)
+		}
+		if got := exportSummary(export); !reflect.DeepEqual(got, tc.msgs) {
+			t.Errorf("%s: %q, want %q", tc.file, got, tc.msgs)
+		}
+	}
+	for dir, want := range map[string]int{"chatexport": 2, "package": 3} {
+		if feeds, err := Import(filepath.Join("testdata", dir)); err != nil || len(feeds) != want {
+			t.Errorf("importing %s: %d feeds, %v", dir, len(feeds), err)
+		}
+	}
+}
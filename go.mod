@@ -2,8 +2,6 @@ module github.com/kavorite/dmsearch
 
 go 1.13
 
-replace github.com/kavorite/discord-spool => ./../discord-spool
-
 require (
 	github.com/Bithack/go-hnsw v0.0.0-20170629124716-52a932462077
 	github.com/DavidBelicza/TextRank v2.1.1+incompatible // indirect
@@ -15,7 +13,6 @@ require (
 	github.com/jdkato/prose v1.1.1
 	github.com/jdkato/prose/v2 v2.0.0
 	github.com/kavorite/discord-snowflake v0.0.0-20200105233840-b8c5aa5ac93d
-	github.com/kavorite/discord-spool v1.0.2
 	github.com/kljensen/snowball v0.6.0
 	github.com/sajari/fuzzy v1.0.0
 	github.com/schollz/progressbar v1.0.0
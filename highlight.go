@@ -0,0 +1,90 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	snowball "github.com/kljensen/snowball/english"
+)
+
+// HighlightMix is the share of a highlight's score that comes from its
+// similarity to the query; the remainder comes from its keyword weight.
+var HighlightMix = 0.7
+
+// Highlight is a key phrase ranked by its relevance to a query. Matched
+// marks the tokens that share a stem with a query term.
+type Highlight struct {
+	ScoredPhrase
+	Sim     float32
+	Score   float64
+	Matched []bool
+}
+
+// String renders the phrase with matched terms in *asterisks*.
+func (hl Highlight) String() string {
+	marked := make([]string, len(hl.Tokens))
+	for i, t := range hl.Tokens {
+		if hl.Matched[i] {
+			t = "*" + t + "*"
+		}
+		marked[i] = t
+	}
+	return strings.Join(marked, " ")
+}
+
+// queryStems collects the stems of the terms in q that are not stop-words.
+func queryStems(q string) map[string]struct{} {
+	terms, skip := Bag(), Bag(stops...)
+	Lex(&terms, q)
+	stemmed := make(map[string]struct{}, len(terms.Dict))
+	for t := range terms.Dict {
+		if t != "" && !skip.Has(t) {
+			stemmed[snowball.Stem(t, false)] = struct{}{}
+		}
+	}
+	return stemmed
+}
+
+// Highlights embeds each of the key phrases of lens the same way queries are
+// embedded, scores them against the query q and returns the best n.
+func (index *Index) Highlights(lens *Lens, q string, n int) []Highlight {
+	v, stemmed := index.VectorizeQuery(q), queryStems(q)
+	wmax := 0.0
+	for _, phrase := range lens.KeyPhrases {
+		if phrase.Weight > wmax {
+			wmax = phrase.Weight
+		}
+	}
+	seen := make(map[string]struct{}, len(lens.KeyPhrases))
+	highlights := make([]Highlight, 0, len(lens.KeyPhrases))
+	for _, phrase := range lens.KeyPhrases {
+		s := strings.Join(phrase.Tokens, " ")
+		if _, ok := seen[s]; ok {
+			continue
+		}
+		seen[s] = struct{}{}
+		hl := Highlight{
+			ScoredPhrase: phrase,
+			Matched:      make([]bool, len(phrase.Tokens)),
+		}
+		if u := index.Vectorize(s); u != nil && v != nil {
+			hl.Sim = v.Sim(u)
+		}
+		for i, t := range phrase.Tokens {
+			_, hl.Matched[i] = stemmed[snowball.Stem(t, false)]
+		}
+		weight := 0.0
+		if wmax > 0 {
+			weight = phrase.Weight / wmax
+		}
+		hl.Score = HighlightMix*float64(hl.Sim) + (1-HighlightMix)*weight
+		highlights = append(highlights, hl)
+	}
+	sort.Slice(highlights, func(i, j int) bool {
+		return highlights[i].Score > highlights[j].Score
+	})
+	if n < len(highlights) {
+		highlights = highlights[:n]
+	}
+	return highlights
+}
@@ -1,101 +1,383 @@
 package main
 
 import (
+	"fmt"
+	"io"
+	"math/rand"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/Bithack/go-hnsw"
+	"github.com/Bithack/go-hnsw/f32"
 	dgo "github.com/bwmarrin/discordgo"
-	"github.com/kavorite/discord-snowflake"
-	"github.com/kavorite/discord-spool"
+	"gonum.org/v1/gonum/blas/blas32"
 )
 
 type Prism struct {
-	*spool.T
+	Feed
 	Vocab
 	Width int
+	Segmentation
+	Weights  *Weights
+	Keywords Keywording
 }
 
+// Origin describes the channel a Lens was distilled from, so that results
+// can be attributed without a live session.
+type Origin struct {
+	ChID       string
+	Recipients []string
+	// GuildID, Guild and Name are only set for guild channels and threads.
+	GuildID, Guild, Name string
+}
+
+// Label names the origin for display: the channel and guild name for guild
+// channels, the recipients for DMs.
+func (o Origin) Label() string {
+	if o.GuildID != "" {
+		return fmt.Sprintf("#%s (%s)", o.Name, o.Guild)
+	}
+	if len(o.Recipients) == 0 {
+		return "nobody"
+	}
+	return strings.Join(o.Recipients, ", ")
+}
+
+// Lens holds named Time and Vec fields rather than embedding them: an
+// embedded time.Time promotes GobEncode and MarshalJSON, which would encode
+// the whole Lens as a bare timestamp.
 type Lens struct {
-	time.Time
-	Vec
-	KeyPhrases    []ScoredPhrase
-	KeyWords      []ScoredPhrase
-	ChID          string
+	Origin
+	// Time is when the newest message in the window was sent.
+	Time       time.Time
+	Vec        Vec
+	KeyPhrases []ScoredPhrase
+	KeyWords   []ScoredPhrase
+	// FirstID and LastID are the oldest and newest messages in the window.
+	FirstID, LastID string
+	// Messages holds the window's messages in chronological order.
+	Messages      []Excerpt
 	ContentLength int
+	// Segmentation is how the window was cut from its channel, and Keywords
+	// what picked its KeyPhrases and KeyWords. Convergence is how TextRank
+	// ended if it was that.
+	Segmentation Segmentation
+	Keywords     Extractor
+	Convergence  *Convergence
 }
 
-func (spl *Prism) Slide(s *dgo.Session) (distillation *Lens, err error) {
-	eb := ALaCarte{
-		Lexer: &PassLex{
-			SanitizerChain{StripPunct, ToLower},
-		},
-		Vocab: spl.Vocab,
+// Excerpt is a single message quoted from a Lens, along with its own vector,
+// which is nil if none of its words has one.
+//
+// Content is the message as sent, which is what is tokenized and indexed, so
+// that mentions stay searchable by ID. Display is the message with mentions
+// replaced by names, if that differs.
+type Excerpt struct {
+	ID, Author, Content string
+	Display             string
+	Vec                 Vec
+}
+
+// Text is the message as it is shown.
+func (x Excerpt) Text() string {
+	if x.Display != "" {
+		return x.Display
 	}
-	bytec := 0
-	tr := RAKE{}
-	err = spl.Unroll(s, func(msg *dgo.Message) bool {
-		bytec += len([]byte(msg.Content))
-		msgid, _ := snowflake.Parse(msg.ID)
-		// TODO: find out why this doesn't work for ngrams with widths smaller
-		// than two
-		tr.Ingest(3, msg.ContentWithMentionsReplaced())
-		Lex(&eb, msg.ContentWithMentionsReplaced())
-		if eb.SampleCount >= spl.Width {
-			scoredTokens, scoredPhrases := tr.Finalize()
-			for _, t := range scoredTokens {
-				eb.Add(eb.Embed(t.Tokens[0]).Scale(float32(t.Weight)))
-			}
-			distillation = &Lens{
-				Time:          msgid.Time(),
-				ContentLength: bytec,
-				Vec:           eb.Finalize(),
-				ChID:          msg.ChannelID,
-				KeyPhrases:    scoredPhrases,
-				KeyWords:      scoredTokens,
+	return x.Content
+}
+
+// Link returns the URL that jumps to the given message in the Discord client.
+func (o Origin) Link(msgID string) string {
+	guild := o.GuildID
+	if guild == "" {
+		guild = "@me"
+	}
+	return fmt.Sprintf("https://discord.com/channels/%s/%s/%s", guild, o.ChID, msgID)
+}
+
+// Slide reads the next window of the feed and distils it into a Lens. The
+// message that ends a window early is handed back to the source to start the
+// next one, as are those past the stride of a sliding window, if the source
+// is an Unreader; otherwise windows neither overlap nor end before a message.
+// The window the source runs out in is distilled however short it is, and
+// io.EOF is only returned by the next call.
+func (spl *Prism) Slide() (distillation *Lens, err error) {
+	seg := spl.Segmentation.withDefaults(spl.Width)
+	unread, _ := spl.MessageSource.(Unreader)
+	var (
+		window []*dgo.Message
+		vecs   []Vec
+		counts []int
+		total  int
+		prev   Vec
+	)
+	err = spl.Unroll(func(msg *dgo.Message) bool {
+		v, n := sample(spl.Vocab, spl.Weights, msg.ContentWithMentionsReplaced())
+		if len(window) > 0 && seg.breaks(total, window[len(window)-1], msg, prev, v) {
+			if unread != nil {
+				unread.Unread(msg)
+			} else {
+				window, vecs = append(window, msg), append(vecs, v)
 			}
 			return false
 		}
-		return true
+		window, vecs, counts = append(window, msg), append(vecs, v), append(counts, n)
+		total += n
+		if v != nil {
+			prev = v
+		}
+		return total < spl.Width
 	})
+	eof := err == io.EOF && len(window) > 0
+	if eof {
+		err = nil
+	}
+	if err != nil {
+		return
+	}
+	if seg.Strategy == Sliding && unread != nil && !eof {
+		i, skipped := 1, counts[0]
+		for i < len(window) && skipped < seg.Stride {
+			skipped += counts[i]
+			i++
+		}
+		unread.Unread(window[i:]...)
+	}
+	distillation = spl.distil(window, vecs)
+	distillation.Segmentation = seg
 	return
 }
 
+// distil embeds and summarizes a window of messages, given in the order the
+// feed yielded them along with their own vectors.
+func (spl *Prism) distil(window []*dgo.Message, vecs []Vec) *Lens {
+	bytec := 0
+	tr := spl.Keywords.New()
+	first, last := "", ""
+	excerpts := make([]Excerpt, 0, len(window))
+	for i, msg := range window {
+		bytec += len([]byte(msg.Content))
+		author := ""
+		if msg.Author != nil {
+			author = msg.Author.String()
+		}
+		excerpt := Excerpt{
+			ID:      msg.ID,
+			Author:  author,
+			Content: msg.Content,
+			Vec:     vecs[i],
+		}
+		if display := msg.ContentWithMentionsReplaced(); display != msg.Content {
+			excerpt.Display = display
+		}
+		excerpts = append(excerpts, excerpt)
+		if first == "" || snowflakeLess(msg.ID, first) {
+			first = msg.ID
+		}
+		if snowflakeLess(last, msg.ID) {
+			last = msg.ID
+		}
+		tr.Ingest(msg.ContentWithMentionsReplaced())
+	}
+	scoredTokens, scoredPhrases := tr.Finalize()
+	var report *Convergence
+	if ranker, ok := tr.(*TextRank); ok {
+		report = &ranker.Convergence
+	}
+	sort.Slice(excerpts, func(i, j int) bool {
+		return snowflakeLess(excerpts[i].ID, excerpts[j].ID)
+	})
+	return &Lens{
+		Origin:        spl.Origin,
+		Time:          idTime(last),
+		ContentLength: bytec,
+		Vec:           spl.embed(excerpts, scoredTokens),
+		KeyPhrases:    scoredPhrases,
+		KeyWords:      scoredTokens,
+		FirstID:       first,
+		LastID:        last,
+		Messages:      excerpts,
+		Keywords:      spl.Keywords.Extractor,
+		Convergence:   report,
+	}
+}
+
+// embed averages the words of a window's messages, and its key words again
+// in proportion to their scores, the best weighing as much as one word.
+func (spl *Prism) embed(excerpts []Excerpt, keywords []ScoredPhrase) Vec {
+	eb := ALaCarte{
+		Lexer: &PassLex{
+			SanitizerChain{StripPunct, ToLower},
+		},
+		Vocab:   spl.Vocab,
+		Oneshot: spl.Weights.pool(),
+		Weights: spl.Weights,
+	}
+	for _, x := range excerpts {
+		EmbedPolicy.Lex(&eb, x.Content)
+	}
+	for _, t := range keywords {
+		if t.Weight > 0 {
+			eb.Weigh(eb.Embed(t.Tokens[0]), float32(t.Weight/keywords[0].Weight))
+		}
+	}
+	return eb.Finalize()
+}
+
+// Graph configures the HNSW index. M and EfConstruction shape the graph as
+// lenses are added; EfSearch is the size of the candidate list kept while
+// querying it. Zero values take the defaults.
+type Graph struct {
+	M, EfConstruction, EfSearch int
+}
+
+func (g Graph) withDefaults() Graph {
+	if g.M <= 0 {
+		g.M = 32
+	}
+	if g.EfConstruction <= 0 {
+		g.EfConstruction = 256
+	}
+	if g.EfSearch <= 0 {
+		g.EfSearch = 64
+	}
+	return g
+}
+
+// build returns an empty graph for vectors of dim components. go-hnsw
+// measures distances with an AVX routine by default, which reads whole
+// blocks of 16 components and so overruns any other number of them.
+func (g Graph) build(dim int) *hnsw.Hnsw {
+	cluster := hnsw.New(g.M, g.EfConstruction, make(hnsw.Point, dim))
+	cluster.DistFunc = f32.L2Squared
+	return cluster
+}
+
+// unit scales a copy of v to unit length. The graph measures squared L2
+// distance, which on unit vectors is 2 - 2cos(u, v), so it ranks the same
+// way Vec.Sim does.
+func unit(v Vec) hnsw.Point {
+	u := make(Vec, len(v))
+	copy(u, v)
+	if n := blas32.Nrm2(u.ToBlas()); n > 0 {
+		blas32.Scal(1/n, u.ToBlas())
+	}
+	return hnsw.Point(u)
+}
+
 type Index struct {
 	Vocab
-	cluster *hnsw.Hnsw
-	qledger map[uint32]*Lens
-	ledgerc int
+	Retrieval
+	Graph
+	Segmentation
+	// OOV, if set, is the layer of Vocab that collects contexts of unknown
+	// words as lenses are added.
+	OOV *Overlay
+	// Spell, if set, corrects query words before they are looked up.
+	Spell *SpellChker
+	// Weights, if set, weigh the words of documents and queries alike.
+	Weights *Weights
+	// Keywords picks the key phrases and words of new lenses.
+	Keywords Keywording
+	lexicon  BM25
+	cluster  *hnsw.Hnsw
+	qledger  map[uint32]*Lens
+	ledgerc  int
+	cursors  map[string]*Cursor
 	sync.RWMutex
 }
 
-func (index *Index) Hydrate(client *dgo.Session, spl *spool.T, width int) (lens *Lens, err error) {
-	prism := Prism{spl, index.Vocab, width}
-	lens, err = prism.Slide(client)
+// Cursor reports how much of the given channel's history has been indexed.
+func (index *Index) Cursor(chID string) (cur Cursor, ok bool) {
+	index.RLock()
+	defer index.RUnlock()
+	if c, ok := index.cursors[chID]; ok {
+		return *c, true
+	}
+	return
+}
+
+// Exhaust marks the given channel's history as indexed back to its first
+// message.
+func (index *Index) Exhaust(chID string) {
+	index.Lock()
+	defer index.Unlock()
+	if index.cursors == nil {
+		index.cursors = make(map[string]*Cursor)
+	}
+	if _, ok := index.cursors[chID]; !ok {
+		index.cursors[chID] = &Cursor{}
+	}
+	index.cursors[chID].Exhausted = true
+}
+
+// CatchUp records that a forward crawl of the given channel has reached its
+// newest message, and so any span indexed live.
+func (index *Index) CatchUp(chID string) {
+	index.Lock()
+	defer index.Unlock()
+	if cur, ok := index.cursors[chID]; ok && cur.LiveNewest != "" {
+		cur.Cover(cur.LiveNewest, cur.LiveNewest)
+	}
+}
+
+// Hydrate distils the next window of feed into a Lens and adds it to the
+// index.
+func (index *Index) Hydrate(feed Feed, width int) (lens *Lens, err error) {
+	return index.hydrate(feed, width, false)
+}
+
+// hydrate is Hydrate for a crawl, or, if live is set, for messages from the
+// gateway, which the crawl cursor must not cover.
+func (index *Index) hydrate(feed Feed, width int, live bool) (lens *Lens, err error) {
+	prism := Prism{feed, index.Vocab, width, index.Segmentation, index.Weights, index.Keywords}
+	lens, err = prism.Slide()
 	if err != nil {
 		return
 	}
+	index.add(lens, live)
+	return
+}
+
+// add inserts a distilled lens into the ledger, the graph and the lexical
+// index, and extends the cursor of its channel over it.
+func (index *Index) add(lens *Lens, live bool) {
+	if index.OOV != nil {
+		for _, msg := range lens.Messages {
+			index.OOV.Observe(tokens(msg.Content))
+		}
+	}
+	terms := lens.terms()
+	// the ledger ID must match the order of insertion into the graph, and
+	// Grow must not run alongside Add, so the whole insertion is serialized
+	index.Lock()
+	defer index.Unlock()
 	if index.cluster == nil {
-		m, efConstruction, zero := 32, 256, make(hnsw.Point, index.Dim())
 		index.ledgerc = 1024
-		index.cluster = hnsw.New(m, efConstruction, zero)
-		index.Lock()
+		index.cluster = index.Graph.withDefaults().build(index.Dim())
 		index.qledger = make(map[uint32]*Lens, index.ledgerc)
-		index.Unlock()
 		index.cluster.Grow(index.ledgerc)
 	} else if len(index.qledger) >= int(0.8*float64(index.ledgerc)) {
 		index.ledgerc *= 2
 		index.cluster.Grow(index.ledgerc)
 	}
-	index.RLock()
 	id := uint32(len(index.qledger) + 1)
-	index.RUnlock()
-	index.Lock()
 	index.qledger[id] = lens
-	index.Unlock()
-	index.cluster.Add(hnsw.Point(lens.Vec), id)
-	return
+	index.lexicon.Add(id, terms)
+	if index.cursors == nil {
+		index.cursors = make(map[string]*Cursor)
+	}
+	if _, ok := index.cursors[lens.ChID]; !ok {
+		index.cursors[lens.ChID] = &Cursor{}
+	}
+	if live {
+		index.cursors[lens.ChID].CoverLive(lens.FirstID, lens.LastID)
+	} else {
+		index.cursors[lens.ChID].Cover(lens.FirstID, lens.LastID)
+	}
+	index.cluster.Add(unit(lens.Vec), id)
 }
 
 type Result struct {
@@ -103,35 +385,213 @@ type Result struct {
 	Distance float32
 }
 
-func (index *Index) Query(q string) (results []Result) {
-	eb := ALaCarte{
-		Vocab: index.Vocab,
-		Lexer: &PassLex{SanitizerChain{StripPunct, ToLower}},
+// Filter restricts a query to the lenses it returns true for.
+type Filter func(*Lens) bool
+
+func admits(filters []Filter, lens *Lens) bool {
+	for _, keep := range filters {
+		if !keep(lens) {
+			return false
+		}
 	}
-	Lex(&eb, q)
-	v := hnsw.Point(eb.Finalize())
-	items := index.cluster.Search(v, 64, len(index.qledger)).Items()
-	// items := index.cluster.SearchBrute(v, len(index.qledger)).Items()
-	results = make([]Result, len(items))
-	for i, item := range items {
-		results[i] = Result{index.qledger[item.ID], item.D}
+	return true
+}
+
+// sanitizer is the chain queries are embedded with. It corrects their
+// spelling when Spell is set; lexical matching does without, since the words
+// the vocabulary lacks are just those it has to match exactly.
+func (index *Index) sanitizer() Sanitizer {
+	if index.Spell != nil {
+		return SanitizerChain{StripPunct, ToLower, *index.Spell}
 	}
-	return
+	return SanitizerChain{StripPunct, ToLower}
 }
 
-func (index *Index) QueryBrute(q string) (results []Result) {
+func (index *Index) embed(s string, sanitizer Sanitizer) Vec {
 	eb := ALaCarte{
-		Vocab: index.Vocab,
-		Lexer: &PassLex{SanitizerChain{StripPunct, ToLower}},
+		Vocab:   index.Vocab,
+		Lexer:   &PassLex{sanitizer},
+		Oneshot: index.Weights.pool(),
+		Weights: index.Weights,
+	}
+	EmbedPolicy.Lex(&eb, s)
+	return eb.Finalize()
+}
+
+// Vectorize embeds free text the same way documents are embedded.
+func (index *Index) Vectorize(s string) Vec {
+	return index.embed(s, SanitizerChain{StripPunct, ToLower})
+}
+
+// VectorizeQuery embeds a query, correcting its spelling if enabled.
+func (index *Index) VectorizeQuery(q string) Vec {
+	return index.embed(q, index.sanitizer())
+}
+
+// Excerpts picks the n messages of lens that best match the query vector v,
+// returned in chronological order.
+func (index *Index) Excerpts(lens *Lens, v Vec, n int) []Excerpt {
+	type scored struct {
+		i   int
+		sim float32
+	}
+	ranked := make([]scored, 0, len(lens.Messages))
+	for i, msg := range lens.Messages {
+		u := msg.Vec
+		if u == nil || v == nil {
+			continue
+		}
+		ranked = append(ranked, scored{i, v.Sim(u)})
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		return ranked[i].sim > ranked[j].sim
+	})
+	if n > len(ranked) {
+		n = len(ranked)
+	}
+	ranked = ranked[:n]
+	sort.Slice(ranked, func(i, j int) bool {
+		return ranked[i].i < ranked[j].i
+	})
+	excerpts := make([]Excerpt, n)
+	for i, r := range ranked {
+		excerpts[i] = lens.Messages[r.i]
+	}
+	return excerpts
+}
+
+// Query searches the HNSW graph for the k lenses nearest to q that filters
+// admit. Their Distance is the cosine similarity, as with QueryBrute.
+func (index *Index) Query(q string, k int, filters ...Filter) []Result {
+	return index.queryVec(index.VectorizeQuery(q), k, filters)
+}
+
+func (index *Index) queryVec(v Vec, k int, filters []Filter) (results []Result) {
+	index.RLock()
+	defer index.RUnlock()
+	n := len(index.qledger)
+	if v == nil || index.cluster == nil || k <= 0 {
+		return
+	}
+	q, ef := unit(v), index.Graph.withDefaults().EfSearch
+	// filters are applied after the search, so widen it until enough of
+	// what it finds passes them
+	// the graph also holds the origin it was seeded with
+	for want := k; ; want *= 4 {
+		if want > n+1 {
+			want = n + 1
+		}
+		if ef < want {
+			ef = want
+		}
+		items := index.cluster.Search(q, ef, want).Items()
+		sort.Slice(items, func(i, j int) bool {
+			return items[i].D < items[j].D
+		})
+		results = results[:0]
+		for _, item := range items {
+			// ID 0 is the origin the graph was seeded with
+			lens := index.qledger[item.ID]
+			if lens == nil || !admits(filters, lens) {
+				continue
+			}
+			results = append(results, Result{lens, 1 - item.D/2})
+			if len(results) == k {
+				return
+			}
+		}
+		if want == n+1 {
+			return
+		}
+	}
+}
+
+func (index *Index) QueryBrute(q string, filters ...Filter) []Result {
+	return index.queryBruteVec(index.VectorizeQuery(q), filters)
+}
+
+func (index *Index) queryBruteVec(v Vec, filters []Filter) (results []Result) {
+	index.RLock()
+	defer index.RUnlock()
+	if v == nil {
+		return
 	}
-	Lex(&eb, q)
-	v := eb.Finalize()
 	results = make([]Result, 0, len(index.qledger))
 	for _, lens := range index.qledger {
-		results = append(results, Result{lens, v.Sim(lens.Vec)})
+		if admits(filters, lens) {
+			results = append(results, Result{lens, v.Sim(lens.Vec)})
+		}
 	}
 	sort.Slice(results, func(i, j int) bool {
 		return results[i].Distance > results[j].Distance
 	})
 	return
 }
+
+// KeywordConvergence reports how many lenses had their keywords ranked by
+// TextRank, how many of those converged, and the mean number of iterations.
+func (index *Index) KeywordConvergence() (ranked, converged int, iterations float64) {
+	index.RLock()
+	defer index.RUnlock()
+	for _, lens := range index.qledger {
+		if report := lens.Convergence; report != nil {
+			ranked++
+			iterations += float64(report.Iterations)
+			if report.Converged {
+				converged++
+			}
+		}
+	}
+	if ranked > 0 {
+		iterations /= float64(ranked)
+	}
+	return
+}
+
+// Recall samples up to n lenses as queries and reports the mean share of
+// their exhaustive k nearest neighbours that the HNSW search also finds,
+// along with the mean time each search took.
+func (index *Index) Recall(k, n int) (recall float64, approx, brute time.Duration) {
+	index.RLock()
+	lenses := make([]*Lens, 0, len(index.qledger))
+	for _, lens := range index.qledger {
+		lenses = append(lenses, lens)
+	}
+	index.RUnlock()
+	if n > len(lenses) {
+		n = len(lenses)
+	}
+	if n == 0 {
+		return
+	}
+	for _, i := range rand.Perm(len(lenses))[:n] {
+		v := lenses[i].Vec
+		t := time.Now()
+		found := index.queryVec(v, k, nil)
+		approx += time.Since(t)
+		t = time.Now()
+		truth := index.queryBruteVec(v, nil)
+		brute += time.Since(t)
+		if len(truth) > k {
+			truth = truth[:k]
+		}
+		if len(truth) == 0 {
+			continue
+		}
+		relevant := make(map[*Lens]struct{}, len(truth))
+		for _, r := range truth {
+			relevant[r.Lens] = struct{}{}
+		}
+		hits := 0
+		for _, r := range found {
+			if _, ok := relevant[r.Lens]; ok {
+				hits++
+			}
+		}
+		recall += float64(hits) / float64(len(truth))
+	}
+	recall /= float64(n)
+	approx /= time.Duration(n)
+	brute /= time.Duration(n)
+	return
+}
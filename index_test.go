@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+
+	dgo "github.com/bwmarrin/discordgo"
+)
+
+// testVocab embeds a handful of words on two topics, pets and weather.
+func testVocab() *Embeddings {
+	return &Embeddings{dim: 4, Dict: map[string]Vec{
+		"cat":    {1, 0.1, 0, 0},
+		"dog":    {0.9, 0.2, 0, 0},
+		"pet":    {0.8, 0, 0.1, 0},
+		"rain":   {0, 0, 1, 0.1},
+		"sunny":  {0, 0.1, 0.9, 0},
+		"cloudy": {0, 0, 0.8, 0.2},
+	}}
+}
+
+// testMessages returns messages to chID with the given contents, a minute
+// apart, starting at start minutes after the Discord epoch.
+func testMessages(chID string, start int, contents ...string) []*dgo.Message {
+	msgs := make([]*dgo.Message, len(contents))
+	for i, content := range contents {
+		ms := int64(start+i) * int64(time.Minute/time.Millisecond)
+		msgs[i] = &dgo.Message{
+			ID:        fmt.Sprint(ms << 22),
+			ChannelID: chID,
+			Content:   content,
+			Author:    &dgo.User{Username: "ann", Discriminator: "0001"},
+		}
+	}
+	return msgs
+}
+
+// TestSlideShort checks that a channel shorter than a window is still
+// distilled, and only then reports io.EOF.
+func TestSlideShort(t *testing.T) {
+	index := &Index{Vocab: testVocab()}
+	feed := Feed{Origin{ChID: "1"}, &Replay{Messages: testMessages("1", 1, "cat dog", "pet cat")}}
+	lens, err := index.Hydrate(feed, 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lens.Messages) != 2 {
+		t.Errorf("lens holds %d messages, want 2", len(lens.Messages))
+	}
+	if _, err = index.Hydrate(feed, 512); err != io.EOF {
+		t.Errorf("second Hydrate: %v, want io.EOF", err)
+	}
+}
+
+// TestRecall checks the graph against exhaustive search at dimensions that
+// are not multiples of 16, which go-hnsw's default distance cannot handle.
+func TestRecall(t *testing.T) {
+	for _, dim := range []int{50, 300} {
+		rng := rand.New(rand.NewSource(1))
+		index := &Index{Vocab: &Embeddings{dim: dim}}
+		for i := 0; i < 500; i++ {
+			v := make(Vec, dim)
+			for j := range v {
+				v[j] = float32(rng.NormFloat64())
+			}
+			id := fmt.Sprint(i + 1)
+			index.add(&Lens{
+				Origin:   Origin{ChID: "1"},
+				Vec:      v,
+				FirstID:  id,
+				LastID:   id,
+				Messages: []Excerpt{{ID: id, Content: "x"}},
+			}, false)
+		}
+		if recall, _, _ := index.Recall(5, 100); recall < 0.95 {
+			t.Errorf("%d dimensions: recall@5 = %.3f", dim, recall)
+		}
+	}
+}
+
+// TestSegmentGap checks that a silence ends even a short window, and that a
+// lens is dated by its newest message.
+func TestSegmentGap(t *testing.T) {
+	index := &Index{Vocab: testVocab(), Segmentation: Segmentation{Strategy: Gap}}
+	msgs := append(testMessages("1", 1, "cat dog", "pet cat"), testMessages("1", 120, "rain sunny")...)
+	feed := Feed{Origin{ChID: "1"}, &Replay{Messages: msgs}}
+	for _, want := range []int{2, 1} {
+		lens, err := index.Hydrate(feed, 512)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(lens.Messages) != want {
+			t.Errorf("lens holds %d messages, want %d", len(lens.Messages), want)
+		}
+		if !lens.Time.Equal(idTime(lens.LastID)) {
+			t.Errorf("lens dated %v, newest message sent %v", lens.Time, idTime(lens.LastID))
+		}
+	}
+}
+
+// TestConvergence checks that TextRank's limits are applied and its report
+// kept on the lens.
+func TestConvergence(t *testing.T) {
+	for _, tc := range []struct {
+		maxIter   int
+		converged bool
+	}{{1, false}, {0, true}} {
+		index := &Index{Vocab: testVocab(), Keywords: Keywording{Extractor: ByTextRank, MaxIter: tc.maxIter}}
+		msgs := testMessages("1", 1, "the cat and the dog chased a pet", "rain made the cat and dog sleep", "sunny days bring the pet out")
+		lens, err := index.Hydrate(Feed{Origin{ChID: "1"}, &Replay{Messages: msgs}}, 512)
+		if err != nil {
+			t.Fatal(err)
+		}
+		report := lens.Convergence
+		if report == nil || report.Converged != tc.converged || tc.maxIter > 0 && report.Iterations != tc.maxIter {
+			t.Errorf("MaxIter %d: report %+v", tc.maxIter, report)
+		}
+	}
+}
+
+// TestUnseen checks that overlapping sliding windows count every message's
+// bytes once.
+func TestUnseen(t *testing.T) {
+	index := &Index{Vocab: testVocab(), Segmentation: Segmentation{Strategy: Sliding, Stride: 2}}
+	contents := []string{"cat dog", "pet", "rain sunny", "cloudy", "cat", "dog pet rain", "sunny"}
+	want := 0
+	for _, content := range contents {
+		want += len(content)
+	}
+	feed := Feed{Origin{ChID: "1"}, &Replay{Messages: testMessages("1", 1, contents...)}}
+	var (
+		counted map[string]struct{}
+		total   int
+		lenses  int
+	)
+	for {
+		lens, err := index.Hydrate(feed, 5)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var n int
+		n, counted = unseen(lens, counted)
+		total += n
+		lenses++
+	}
+	if lenses < 3 || total != want {
+		t.Errorf("%d bytes counted over %d lenses, want %d", total, lenses, want)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Inducer fits the à-la-carte transform: the linear map A for which A·u
+// best approximates v, in the least-squares sense, over the words of a corpus
+// whose vector v is known and whose occurrences have the mean context vector
+// u. Applied to the context mean of a word the vocabulary lacks, A then
+// estimates the vector it would have had.
+type Inducer struct {
+	*Spanner
+	Vocab
+	// MinCount is the number of occurrences below which a word's context
+	// mean is too noisy to fit against.
+	MinCount int
+	contexts map[string]*ContextMean
+}
+
+// ContextMean accumulates the vectors found around a word's occurrences. N
+// counts the vectors summed and Windows the occurrences they came from.
+type ContextMean struct {
+	Sum        Vec
+	N, Windows int
+}
+
+// Add sums the vectors of ctx, skipping position mid and unknown words.
+func (ctx *ContextMean) Add(vocab Vocab, window []string, mid int) {
+	if ctx.Sum == nil {
+		ctx.Sum = make(Vec, vocab.Dim())
+	}
+	for i, t := range window {
+		v := vocab.Embed(t)
+		if i == mid || v == nil {
+			continue
+		}
+		for j, x := range v {
+			ctx.Sum[j] += x
+		}
+		ctx.N++
+	}
+	ctx.Windows++
+}
+
+// Mean is the average context vector, or nil if none was summed.
+func (ctx *ContextMean) Mean() (u Vec) {
+	if ctx.N == 0 {
+		return
+	}
+	u = make(Vec, len(ctx.Sum))
+	for i, x := range ctx.Sum {
+		u[i] = x / float32(ctx.N)
+	}
+	return
+}
+
+// NewInducer collects the words within side tokens either way of each
+// occurrence as its context.
+func NewInducer(vocab Vocab, side, minCount int) *Inducer {
+	lexer := &PassLex{SanitizerChain{StripPunct, ToLower}}
+	return &Inducer{
+		Spanner:  NewSpanner(2*side+1, lexer),
+		Vocab:    vocab,
+		MinCount: minCount,
+		contexts: make(map[string]*ContextMean),
+	}
+}
+
+func (ind *Inducer) Advance(t string) bool {
+	if t == "" {
+		return true
+	}
+	if !ind.Spanner.Advance(t) {
+		return false
+	}
+	if len(ind.Context) < ind.Span {
+		return true
+	}
+	mid := ind.Span / 2
+	w := ind.Context[mid]
+	if ind.Vocab.Embed(w) == nil {
+		return true
+	}
+	ctx, ok := ind.contexts[w]
+	if !ok {
+		ctx = &ContextMean{}
+		ind.contexts[w] = ctx
+	}
+	ctx.Add(ind.Vocab, ind.Context, mid)
+	return true
+}
+
+// Fit solves the normal equations (ΣuuT)X = ΣuvT and returns A = XT.
+func (ind *Inducer) Fit() (A *mat.Dense, err error) {
+	d := ind.Dim()
+	gram, cross := mat.NewDense(d, d, nil), mat.NewDense(d, d, nil)
+	u, v := mat.NewVecDense(d, nil), mat.NewVecDense(d, nil)
+	n := 0
+	for w, ctx := range ind.contexts {
+		if ctx.Windows < ind.MinCount || ctx.N == 0 {
+			continue
+		}
+		target := ind.Vocab.Embed(w)
+		for i := 0; i < d; i++ {
+			u.SetVec(i, float64(ctx.Sum[i])/float64(ctx.N))
+			v.SetVec(i, float64(target[i]))
+		}
+		gram.RankOne(gram, 1, u, u)
+		cross.RankOne(cross, 1, u, v)
+		n++
+	}
+	if n < d {
+		err = fmt.Errorf("%d words occur at least %d times; at least %d are needed", n, ind.MinCount, d)
+		return
+	}
+	var X mat.Dense
+	if err = X.Solve(gram, cross); err != nil {
+		return
+	}
+	A = mat.DenseCopyOf(X.T())
+	return
+}
+
+// SaveInduction writes A in gonum's binary matrix format.
+func SaveInduction(path string, A *mat.Dense) (err error) {
+	buf, err := A.MarshalBinary()
+	if err != nil {
+		return
+	}
+	return ioutil.WriteFile(path, buf, 0644)
+}
+
+// LoadInduction reads a matrix written by SaveInduction.
+func LoadInduction(path string) (A *mat.Dense, err error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	A = &mat.Dense{}
+	if err = A.UnmarshalBinary(buf); err != nil {
+		err = fmt.Errorf("%s: %s", path, err)
+	}
+	return
+}
+
+// inducted applies the transform for len(u) components to u in place.
+func inducted(u Vec) Vec {
+	A := induction(len(u))
+	if A == nil {
+		return u
+	}
+	v := mat.NewDense(len(u), 1, nil)
+	v.Mul(A, u)
+	for i := range u {
+		u[i] = float32(v.RawMatrix().Data[i])
+	}
+	return u
+}
+
+// induction returns the transform that Oneshot.Finalize applies to averages
+// of dim components: inductionMatrix if it fits them, or nil, standing for
+// the identity, if it does not.
+func induction(dim int) mat.Matrix {
+	if r, c := inductionMatrix.Dims(); r == dim && c == dim {
+		return inductionMatrix
+	}
+	return nil
+}
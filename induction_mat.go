@@ -2,6 +2,9 @@ package main
 
 import "gonum.org/v1/gonum/mat"
 
+// inductionMatrix is the à-la-carte transform applied to averaged vectors. It
+// defaults to one fitted for 300-dimensional vectors and is replaced by the
+// one given with -induction.
 var inductionMatrix = mat.NewDense(300, 300, inductionMatrixData[:])
 
 var inductionMatrixData = [...]float64{
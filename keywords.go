@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/jdkato/prose/v2"
+)
+
+// KeywordExtractor scores the words and phrases of a window of messages, fed
+// to it one at a time.
+type KeywordExtractor interface {
+	Ingest(src string)
+	// Finalize returns the scored words and phrases, best first.
+	Finalize() (tokens, phrases []ScoredPhrase)
+}
+
+type ScoredPhrase struct {
+	Weight float64
+	Tokens []string
+}
+
+// Extractor names a KeywordExtractor.
+type Extractor string
+
+const (
+	ByRAKE     Extractor = "rake"
+	ByTextRank Extractor = "textrank"
+	ByYAKE     Extractor = "yake"
+)
+
+func (x Extractor) Valid() error {
+	switch x {
+	case ByRAKE, ByTextRank, ByYAKE:
+		return nil
+	}
+	return fmt.Errorf("keyword extractor %q not recognized", string(x))
+}
+
+// Keywording configures the extractor that picks the key phrases of new
+// lenses. Damping, Tolerance and MaxIter bound TextRank's iteration; zero
+// values take the defaults.
+type Keywording struct {
+	Extractor Extractor
+	Damping   float64
+	Tolerance float64
+	MaxIter   int
+}
+
+// New returns an empty extractor of the configured kind, RAKE by default.
+func (kw Keywording) New() KeywordExtractor {
+	switch kw.Extractor {
+	case ByTextRank:
+		return &TextRank{Damping: kw.Damping, Tolerance: kw.Tolerance, MaxIter: kw.MaxIter}
+	case ByYAKE:
+		return &YAKE{}
+	}
+	return &RAKE{}
+}
+
+// maxPhrase is the number of words in the longest candidate phrase.
+const maxPhrase = 3
+
+// word is a token as keyword extractors see it: Raw as written, and Text
+// sanitized, or empty for punctuation.
+type word struct {
+	Raw, Text string
+}
+
+// passage collects the words of a window sentence by sentence. Candidate
+// phrases are the runs of up to maxPhrase words between stop words and
+// punctuation.
+type passage struct {
+	Sentences [][]word
+}
+
+var (
+	stopBag     = Bag(stops...)
+	sentenceEnd = map[string]struct{}{".": {}, "!": {}, "?": {}}
+)
+
+func (p *passage) Ingest(src string) {
+	doc, err := prose.NewDocument(src,
+		prose.WithSegmentation(false),
+		prose.WithTagging(false),
+		prose.WithExtraction(false))
+	if err != nil {
+		return
+	}
+	sanitizer := SanitizerChain{StripPunct, ToLower}
+	var sent []word
+	for _, t := range doc.Tokens() {
+		sent = append(sent, word{t.Text, sanitizer.Sanitize(t.Text)})
+		if _, ok := sentenceEnd[t.Text]; ok {
+			p.Sentences, sent = append(p.Sentences, sent), nil
+		}
+	}
+	if len(sent) > 0 {
+		p.Sentences = append(p.Sentences, sent)
+	}
+}
+
+// stop reports whether w breaks candidate phrases.
+func (w word) stop() bool {
+	return w.Text == "" || stopBag.Has(w.Text)
+}
+
+// candidates calls fn with every candidate phrase of each sentence, given as
+// the index of the sentence and its sanitized words.
+func (p *passage) candidates(fn func(sent int, phrase []string)) {
+	for i, sent := range p.Sentences {
+		var phrase []string
+		for _, w := range sent {
+			if w.stop() || len(phrase) == maxPhrase {
+				if len(phrase) > 0 {
+					fn(i, phrase)
+				}
+				phrase = nil
+			}
+			if !w.stop() {
+				phrase = append(phrase, w.Text)
+			}
+		}
+		if len(phrase) > 0 {
+			fn(i, phrase)
+		}
+	}
+}
+
+// ranked sorts scores into ScoredPhrases, best first.
+func ranked(scores map[string]float64, tokens map[string][]string) (ranking []ScoredPhrase) {
+	keys := make([]string, 0, len(scores))
+	for k := range scores {
+		keys = append(keys, k)
+	}
+	// ties are broken alphabetically rather than by map order
+	sort.Strings(keys)
+	ranking = make([]ScoredPhrase, len(keys))
+	for i, k := range keys {
+		ranking[i] = ScoredPhrase{scores[k], tokens[k]}
+	}
+	sort.SliceStable(ranking, func(i, j int) bool {
+		return ranking[i].Weight > ranking[j].Weight
+	})
+	return
+}
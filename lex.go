@@ -1,7 +1,7 @@
 package main
 
 import (
-	"fmt"
+	"bufio"
 	"io"
 	"strings"
 	"unicode"
@@ -14,14 +14,27 @@ func Lex(lexer Lexer, src string) error {
 	return LexStrm(lexer, rd)
 }
 
+// LexStrm feeds lexer the whitespace-separated tokens of istrm until it
+// declines one or istrm runs out. Running out is not an error; failing to
+// read is.
 func LexStrm(lexer Lexer, istrm io.Reader) (err error) {
-	t := ""
-	_, err = fmt.Fscanf(istrm, "%s ", &t)
-	t = lexer.Sanitize(t)
-	if err != nil || !lexer.Advance(t) {
-		return
+	sc := bufio.NewScanner(istrm)
+	sc.Split(scanWords)
+	for sc.Scan() {
+		if !lexer.Advance(lexer.Sanitize(sc.Text())) {
+			return
+		}
+	}
+	return sc.Err()
+}
+
+// scanWords is bufio.ScanWords, except that a run of non-space longer than
+// the Scanner's buffer is cut into pieces instead of ending the scan.
+func scanWords(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	advance, token, err = bufio.ScanWords(data, atEOF)
+	if advance == 0 && token == nil && err == nil && len(data) >= bufio.MaxScanTokenSize {
+		return bufio.ScanWords(data, true)
 	}
-	err = LexStrm(lexer, istrm)
 	return
 }
 
@@ -51,12 +64,18 @@ var (
 
 type SanitizerChain []Sanitizer
 
+// SpellChker corrects words that Vocab does not know to the likeliest word
+// of its model. A nil Vocab treats every word as unknown.
 type SpellChker struct {
 	*fuzzy.Model
+	Vocab
 }
 
 func (cker SpellChker) Sanitize(t string) string {
-	return cker.SpellCheck(t)
+	if s := cker.Suggest(t); s != "" {
+		return s
+	}
+	return t
 }
 
 func (chain SanitizerChain) Sanitize(t string) string {
@@ -103,3 +122,16 @@ func (spanner *Spanner) Advance(t string) bool {
 	}
 	return true
 }
+
+// Collector is a Lexer that keeps every sanitized token it is given.
+type Collector struct {
+	Sanitizer
+	Tokens []string
+}
+
+func (lexer *Collector) Advance(t string) bool {
+	if t != "" {
+		lexer.Tokens = append(lexer.Tokens, t)
+	}
+	return true
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// counter counts and measures the tokens it is fed without keeping them.
+type counter struct {
+	Sanitizer
+	n, size, longest int
+}
+
+func (c *counter) Advance(t string) bool {
+	c.n++
+	c.size += len(t)
+	if len(t) > c.longest {
+		c.longest = len(t)
+	}
+	return true
+}
+
+var identity = SanitizerFunc(func(t string) string { return t })
+
+func TestLexLong(t *testing.T) {
+	run := strings.Repeat("a", 200<<10)
+	lexer := Collector{Sanitizer: identity}
+	if err := Lex(&lexer, "before "+run+" after"); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(lexer.Tokens); n != 6 || lexer.Tokens[0] != "before" || lexer.Tokens[n-1] != "after" {
+		t.Fatalf("%d tokens", n)
+	}
+	size := 0
+	for _, tok := range lexer.Tokens[1:5] {
+		if len(tok) > 64<<10 {
+			t.Errorf("piece of %d bytes", len(tok))
+		}
+		size += len(tok)
+	}
+	if size != len(run) {
+		t.Errorf("pieces add up to %d bytes, want %d", size, len(run))
+	}
+
+	const n = 1000000
+	c := counter{Sanitizer: identity}
+	if err := LexStrm(&c, strings.NewReader(strings.Repeat("word ", n))); err != nil {
+		t.Fatal(err)
+	}
+	if c.n != n || c.size != 4*n || c.longest != 4 {
+		t.Errorf("%d tokens of %d bytes", c.n, c.size)
+	}
+}
+
+// failReader fails every read.
+type failReader struct{ err error }
+
+func (r failReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+func TestLexError(t *testing.T) {
+	broken := errors.New("connection reset")
+	lexer := Collector{Sanitizer: identity}
+	err := LexStrm(&lexer, io.MultiReader(strings.NewReader("cat dog "), failReader{broken}))
+	if err != broken {
+		t.Errorf("error %v, want %v", err, broken)
+	}
+	if strings.Join(lexer.Tokens, " ") != "cat dog" {
+		t.Errorf("tokens %q before the error", lexer.Tokens)
+	}
+	if err = LexStrm(&lexer, failReader{io.EOF}); err != nil {
+		t.Errorf("EOF reported as %v", err)
+	}
+}
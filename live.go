@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"sync"
+
+	dgo "github.com/bwmarrin/discordgo"
+)
+
+// Gateway is the part of *dgo.Session that live indexing needs, so that a
+// fake can stand in for the websocket.
+type Gateway interface {
+	AddHandler(handler interface{}) func()
+	Open() error
+	Close() error
+}
+
+// errPending is returned by a Backlog that runs out of messages before a
+// window closes. Unlike io.EOF it does not end the window, which is retried
+// from the same start once the next message arrives.
+var errPending = errors.New("window pending")
+
+// Backlog buffers a channel's incoming messages. Unroll consumes them only
+// once a window closes; if they run out first it rewinds and returns
+// errPending.
+type Backlog struct {
+	msgs   []*dgo.Message
+	next   int
+	cursor string
+}
+
+func (b *Backlog) Push(msg *dgo.Message) {
+	b.msgs = append(b.msgs, msg)
+}
+
+func (b *Backlog) Unroll(fn func(*dgo.Message) bool) error {
+	for b.next < len(b.msgs) {
+		msg := b.msgs[b.next]
+		b.next++
+		if !fn(msg) {
+			b.msgs = b.msgs[b.next:]
+			b.next = 0
+			b.cursor = msg.ID
+			return nil
+		}
+	}
+	b.next = 0
+	return errPending
+}
+
+func (b *Backlog) Unread(msgs ...*dgo.Message) {
+	b.msgs = append(msgs[:len(msgs):len(msgs)], b.msgs...)
+}
+
+// Cursor is the last message consumed into a window.
+func (b *Backlog) Cursor() string {
+	return b.cursor
+}
+
+// Live folds MessageCreate events into an Index as they arrive.
+type Live struct {
+	*Index
+	Width int
+	// Filter selects the messages to index; nil accepts everything.
+	Filter func(*dgo.Message) bool
+	// Resolve describes a channel the first time it is seen; nil records
+	// only its ID.
+	Resolve  func(chID string) Origin
+	backlogs map[string]*Backlog
+	origins  map[string]Origin
+	sync.Mutex
+}
+
+// Ingest buffers msg and returns the Lens it completed, if any.
+func (live *Live) Ingest(msg *dgo.Message) (lens *Lens, err error) {
+	if live.Filter != nil && !live.Filter(msg) {
+		return
+	}
+	live.Lock()
+	defer live.Unlock()
+	if live.backlogs == nil {
+		live.backlogs = make(map[string]*Backlog)
+		live.origins = make(map[string]Origin)
+	}
+	backlog, ok := live.backlogs[msg.ChannelID]
+	if !ok {
+		backlog = &Backlog{}
+		live.backlogs[msg.ChannelID] = backlog
+		origin := Origin{ChID: msg.ChannelID}
+		if live.Resolve != nil {
+			origin = live.Resolve(msg.ChannelID)
+		}
+		live.origins[msg.ChannelID] = origin
+	}
+	backlog.Push(msg)
+	lens, err = live.hydrate(Feed{live.origins[msg.ChannelID], backlog}, live.Width, true)
+	if err == errPending {
+		err = nil
+	}
+	return
+}
+
+// Listen subscribes to gw and opens it. The returned func detaches the
+// handler and closes the connection.
+func (live *Live) Listen(gw Gateway, errs func(error)) (stop func(), err error) {
+	detach := gw.AddHandler(func(s *dgo.Session, evt *dgo.MessageCreate) {
+		if _, err := live.Ingest(evt.Message); err != nil && errs != nil {
+			errs(err)
+		}
+	})
+	if err = gw.Open(); err != nil {
+		detach()
+		return
+	}
+	stop = func() {
+		detach()
+		gw.Close()
+	}
+	return
+}
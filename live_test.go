@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+
+	dgo "github.com/bwmarrin/discordgo"
+)
+
+// fakeGateway stands in for the websocket, handing events straight to the
+// handler Live registers.
+type fakeGateway struct {
+	handler func(*dgo.Session, *dgo.MessageCreate)
+	open    bool
+}
+
+func (gw *fakeGateway) AddHandler(handler interface{}) func() {
+	gw.handler = handler.(func(*dgo.Session, *dgo.MessageCreate))
+	return func() { gw.handler = nil }
+}
+
+func (gw *fakeGateway) Open() error {
+	gw.open = true
+	return nil
+}
+
+func (gw *fakeGateway) Close() error {
+	gw.open = false
+	return nil
+}
+
+func TestLive(t *testing.T) {
+	index := &Index{Vocab: testVocab()}
+	live := &Live{Index: index, Width: 8}
+	gw := &fakeGateway{}
+	stop, err := live.Listen(gw, func(err error) { t.Error(err) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gw.open || gw.handler == nil {
+		t.Fatal("Listen did not subscribe and open the gateway")
+	}
+	msgs := testMessages("1", 1, "cat dog pet", "dog cat pet", "pet dog cat", "rain")
+	for i, msg := range msgs {
+		gw.handler(nil, &dgo.MessageCreate{Message: msg})
+		index.RLock()
+		n := len(index.qledger)
+		index.RUnlock()
+		// the third message brings the window to its width
+		want := 0
+		if i >= 2 {
+			want = 1
+		}
+		if n != want {
+			t.Fatalf("after %d messages: %d lenses, want %d", i+1, n, want)
+		}
+	}
+	lens := index.qledger[1]
+	if len(lens.Messages) != 3 || lens.FirstID != msgs[0].ID || lens.LastID != msgs[2].ID {
+		t.Errorf("lens spans %d messages from %s to %s", len(lens.Messages), lens.FirstID, lens.LastID)
+	}
+	stop()
+	if gw.open || gw.handler != nil {
+		t.Error("stop did not detach and close the gateway")
+	}
+}
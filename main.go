@@ -6,13 +6,13 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"net/http"
 	"os"
 	"strings"
 	"sync"
 	"time"
 
 	dgo "github.com/bwmarrin/discordgo"
-	"github.com/kavorite/discord-spool"
 	pb "github.com/schollz/progressbar/v3"
 )
 
@@ -66,18 +66,79 @@ func (sig Semaphore) Free(n int) {
 }
 
 var (
-	token    string
-	datamass string
-	wordpath string
-	docsize  uint
+	token     string
+	datamass  string
+	wordpath  string
+	wordfmt   string
+	subword   string
+	ngrams    Subword
+	buckets   int
+	induced   string
+	side      int
+	mincount  int
+	oovcount  int
+	spell     bool
+	indexpath string
+	docsize   uint
+	refresh   bool
+	backfill  bool
+	live      bool
+	sources   Selector
+	addr      string
+	retrieval Retrieval
+	segments  Segmentation
+	drift     float64
+	weighting Weighting
+	keywords  Keywording
+	graph     Graph
+	samples   int
+	importdir string
 )
 
-func main() {
-	flag.StringVar(&token, "T", "", "Discord authentication token")
-	flag.StringVar(&datamass, "B", "8k", "datamass to retrieve from each channel in units of [K]iB, [M]iB, and [G]iB")
-	flag.StringVar(&wordpath, "vocab", "", "path to word2vec embeddings")
-	flag.UintVar(&docsize, "doc", 512, "number of lexical units to include in a single content-block")
-	flag.Parse()
+func originOf(s *dgo.Session, ch *dgo.Channel) Origin {
+	recipients := make([]string, 0, len(ch.Recipients))
+	for _, u := range ch.Recipients {
+		recipients = append(recipients, u.String())
+	}
+	origin := Origin{ChID: ch.ID, Recipients: recipients}
+	if ch.GuildID != "" {
+		origin.GuildID, origin.Guild, origin.Name = ch.GuildID, ch.GuildID, ch.Name
+		if g, err := s.Guild(ch.GuildID); err == nil {
+			origin.Guild = g.Name
+		}
+	}
+	return origin
+}
+
+// passes plans the crawls needed to bring a channel up to date. Channels
+// without a single indexed window are walked from their newest message
+// backward; a refresh fills in what came before the span indexed live and
+// resumes after it.
+func passes(index *Index, client *dgo.Session, ch *dgo.Channel) (spls []MessageSource) {
+	cur, ok := index.Cursor(ch.ID)
+	if !ok || cur.Newest == "" {
+		if !ok || refresh {
+			spls = append(spls, &Walk{Session: client, ChID: ch.ID})
+		}
+		return
+	}
+	if refresh {
+		spls = append(spls, &Walk{
+			Session:  client,
+			ChID:     ch.ID,
+			Anchor:   cur.Newest,
+			Forward:  true,
+			SkipFrom: cur.LiveOldest,
+			SkipTo:   cur.LiveNewest,
+		})
+	}
+	if backfill && !cur.Exhausted {
+		spls = append(spls, &Walk{Session: client, ChID: ch.ID, Anchor: cur.Oldest})
+	}
+	return
+}
+
+func session() *dgo.Session {
 	if token == "" {
 		token = os.Getenv("DMSEARCH_TOKEN")
 	}
@@ -88,15 +149,167 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	return client
+}
+
+func crawl(index *Index, client *dgo.Session) {
 	maxbytec, err := bytes(datamass)
 	if err != nil {
 		panic(err)
 	}
-	istrm, err := os.Open(wordpath)
+	chs, err := sources.Channels(client)
 	if err != nil {
 		panic(err)
 	}
-	vocab := &Embeddings{}
+	indexing := sync.WaitGroup{}
+	indexing.Add(len(chs))
+	workerlk := make(Semaphore, 32)
+	fmt.Println()
+	fmt.Println("Index channels...")
+	bar := pb.New(len(chs) * maxbytec)
+	for _, ch := range chs {
+		workerlk.Rsrv(1)
+		go func(target *dgo.Channel) {
+			defer indexing.Done()
+			defer workerlk.Free(1)
+			bytec := 0
+			origin := originOf(client, target)
+			for _, spl := range passes(index, client, target) {
+				var counted map[string]struct{}
+				for bytec < maxbytec {
+					lens, err := index.Hydrate(Feed{origin, spl}, int(docsize))
+					// Hydrate returns the oldest window, however short, before
+					// io.EOF, so the channel is only marked exhausted once
+					// all of it is indexed
+					if err == io.EOF {
+						if w, ok := spl.(*Walk); ok && w.Forward {
+							index.CatchUp(target.ID)
+						} else {
+							index.Exhaust(target.ID)
+						}
+						break
+					}
+					if forbidden(err) {
+						break
+					}
+					if err != nil {
+						panic(err)
+					}
+					var progress int
+					progress, counted = unseen(lens, counted)
+					bytec += progress
+					if bytec >= maxbytec {
+						progress -= bytec - maxbytec
+					}
+					bar.Add(progress)
+				}
+			}
+			if bytec < maxbytec {
+				bar.Add(maxbytec - bytec)
+			}
+		}(ch)
+	}
+	indexing.Wait()
+	fmt.Println()
+}
+
+// unseen sums the bytes of the lens's messages that are not among counted,
+// those of the lens before it, and returns its own to count the next against.
+// Sliding windows overlap, but a message the lens shares with any earlier one
+// is also in the one just before.
+func unseen(lens *Lens, counted map[string]struct{}) (bytec int, own map[string]struct{}) {
+	own = make(map[string]struct{}, len(lens.Messages))
+	for _, msg := range lens.Messages {
+		own[msg.ID] = struct{}{}
+		if _, ok := counted[msg.ID]; !ok {
+			bytec += len(msg.Content)
+		}
+	}
+	return
+}
+
+// ingest indexes local message sources in full.
+func ingest(index *Index, feeds []Feed) {
+	indexing := sync.WaitGroup{}
+	indexing.Add(len(feeds))
+	workerlk := make(Semaphore, 32)
+	fmt.Println()
+	fmt.Println("Index export...")
+	bar := pb.New(len(feeds))
+	for _, feed := range feeds {
+		workerlk.Rsrv(1)
+		go func(feed Feed) {
+			defer indexing.Done()
+			defer workerlk.Free(1)
+			defer bar.Add(1)
+			if closer, ok := feed.MessageSource.(io.Closer); ok {
+				defer closer.Close()
+			}
+			for {
+				_, err := index.Hydrate(feed, int(docsize))
+				if err == io.EOF {
+					index.Exhaust(feed.ChID)
+					return
+				}
+				if err != nil {
+					panic(err)
+				}
+			}
+		}(feed)
+	}
+	indexing.Wait()
+	fmt.Println()
+}
+
+// loadSpeller reads the spelling model kept next to the index, or trains
+// one on it and seed and saves it there if it is missing or stale.
+func loadSpeller(index *Index, known Vocab, seed Enumerable, stale bool) (cker *SpellChker) {
+	cker = &SpellChker{Vocab: known}
+	if indexpath != "" && !stale {
+		if err := cker.Load(indexpath); err == nil {
+			return
+		} else if !os.IsNotExist(err) {
+			panic(err)
+		}
+	}
+	fmt.Println("Train spelling model...")
+	cker.Train(index, seed)
+	if indexpath != "" {
+		if err := cker.Save(indexpath); err != nil {
+			panic(err)
+		}
+	}
+	return
+}
+
+// induce fits the à-la-carte transform on the text files at paths and writes
+// it to -induction.
+func induce(vocab Vocab, paths []string) {
+	ind := NewInducer(vocab, side, mincount)
+	for _, path := range paths {
+		fmt.Printf("\nRead %s...\n", path)
+		istrm, err := os.Open(path)
+		if err != nil {
+			panic(err)
+		}
+		if err = LexStrm(ind, istrm); err != nil {
+			panic(err)
+		}
+		istrm.Close()
+	}
+	fmt.Println("Fit transform...")
+	A, err := ind.Fit()
+	if err != nil {
+		panic(err)
+	}
+	if err = SaveInduction(induced, A); err != nil {
+		panic(err)
+	}
+}
+
+// readEmbeddings buffers embeddings in the given format into memory.
+func readEmbeddings(istrm *os.File, format string) (vocab *Embeddings) {
+	vocab = &Embeddings{}
 	fmt.Println("Buffer embeddings...")
 	end, err := istrm.Seek(0, os.SEEK_END)
 	if err != nil {
@@ -117,85 +330,333 @@ func main() {
 			prev = n
 		}
 	}()
-	if err = vocab.ReadBin(istrm); err != nil {
+	if err = vocab.Read(istrm, format); err != nil {
+		panic(err)
+	}
+	return
+}
+
+func main() {
+	flag.StringVar(&token, "T", "", "Discord authentication token")
+	flag.StringVar(&datamass, "B", "8k", "datamass to retrieve from each channel in units of [K]iB, [M]iB, and [G]iB")
+	flag.StringVar(&wordpath, "vocab", "", "path to word2vec (binary or text), GloVe or fastText .vec embeddings, or to a store written by convert")
+	flag.StringVar(&wordfmt, "vocab-format", FormatAuto, "format of the embeddings: auto, bin, txt, vec, glove or store")
+	flag.StringVar(&subword, "subword", "", `embed out-of-vocabulary words from character n-grams: a fastText .bin model, or "hash" to hash n-grams of the vocabulary`)
+	flag.IntVar(&ngrams.MinN, "minn", 3, "shortest n-gram to hash with -subword=hash")
+	flag.IntVar(&ngrams.MaxN, "maxn", 6, "longest n-gram to hash with -subword=hash")
+	flag.IntVar(&buckets, "buckets", 1<<17, "number of n-gram buckets to hash with -subword=hash")
+	flag.StringVar(&induced, "induction", "", "path to an à-la-carte transform; written by induce, loaded otherwise")
+	flag.IntVar(&side, "span", 5, "number of context words either side of a word to induce its vector from")
+	flag.IntVar(&mincount, "mincount", 10, "number of occurrences a word needs to be fitted on in induce mode")
+	flag.IntVar(&oovcount, "oov", 3, "induce vectors for out-of-vocabulary words seen at least this many times while indexing; 0 disables")
+	flag.BoolVar(&spell, "spell", false, "correct misspelled query words before searching")
+	flag.StringVar((*string)(&segments.Strategy), "segment", string(Fixed), "how to cut channels into windows: fixed, gap, sliding or topic")
+	flag.DurationVar(&segments.Gap, "gap", 30*time.Minute, "silence that ends a window with -segment=gap")
+	flag.IntVar(&segments.Stride, "stride", 0, "number of tokens between the starts of windows with -segment=sliding; half of -doc if zero")
+	flag.Float64Var(&drift, "drift", 0.8, "cosine distance between consecutive messages that ends a window with -segment=topic")
+	flag.IntVar(&segments.MinWidth, "minwidth", 0, "number of tokens a window must hold before a gap or topic shift may end it")
+	flag.StringVar((*string)(&weighting.Scheme), "weighting", string(Uniform), "how to weigh words when averaging their vectors: uniform, tfidf or sif")
+	flag.Float64Var(&weighting.A, "sif-a", 1e-3, "smoothing of -weighting=sif; the smaller, the less frequent words count")
+	flag.BoolVar(&weighting.RemovePC, "remove-pc", false, "remove the first principal component of the lens vectors from every vector")
+	flag.StringVar((*string)(&weighting.Pooling), "pooling", string(WeightedMean), "how to pool word vectors: mean, weighted (by -weighting) or max")
+	flag.BoolVar(&weighting.Normalize, "normalize", false, "scale pooled vectors to unit length")
+	flag.StringVar((*string)(&keywords.Extractor), "keywords", string(ByRAKE), "how to pick the key phrases of new windows: rake, textrank or yake")
+	flag.Float64Var(&keywords.Damping, "textrank-damping", 0.85, "probability that TextRank follows an edge with -keywords=textrank")
+	flag.Float64Var(&keywords.Tolerance, "textrank-tol", 1e-6, "squared change in ranks at which TextRank stops with -keywords=textrank")
+	flag.IntVar(&keywords.MaxIter, "textrank-iter", 100, "most iterations TextRank runs with -keywords=textrank")
+	flag.StringVar(&indexpath, "index", "", "path to an index snapshot; loaded if it exists, written after indexing otherwise")
+	flag.UintVar(&docsize, "doc", 512, "number of lexical units to include in a single content-block")
+	flag.BoolVar(&refresh, "refresh", false, "index messages newer than those covered by the loaded snapshot")
+	flag.BoolVar(&backfill, "backfill", false, "continue indexing further back than the loaded snapshot reaches")
+	flag.BoolVar(&sources.DMs, "dms", true, "index direct and group messages")
+	flag.Var((*listFlag)(&sources.Guilds), "guild", "comma-separated IDs of guilds whose text channels and threads to index")
+	flag.Var((*listFlag)(&sources.Include), "chan", "comma-separated channel IDs or name globs to index; all admitted channels if empty")
+	flag.Var((*listFlag)(&sources.Exclude), "xchan", "comma-separated channel IDs or name globs to skip")
+	flag.StringVar(&importdir, "import", "", "build the index offline from a Discord data package, DiscordChatExporter JSON or a JSONL message log instead of the API")
+	flag.BoolVar(&live, "live", false, "keep indexing new messages from the gateway while the prompt is open")
+	flag.StringVar((*string)(&retrieval.Mode), "mode", string(Semantic), "retrieval mode: semantic, lexical or hybrid")
+	flag.BoolVar(&retrieval.Weighted, "weighted", false, "fuse hybrid rankings by weighted sum instead of reciprocal rank")
+	flag.Float64Var(&retrieval.Alpha, "alpha", 0.5, "weight of the semantic score in a weighted hybrid ranking")
+	flag.BoolVar(&retrieval.Approx, "approx", false, "rank semantically through the HNSW graph instead of exhaustively")
+	flag.IntVar(&retrieval.K, "k", 8, "number of results to show")
+	flag.IntVar(&retrieval.Rerank, "rerank", 0, "find single messages within this many of the best windows instead of listing windows")
+	flag.Float64Var(&retrieval.RerankAlpha, "rerank-alpha", 0.5, "weight of the semantic score when -rerank scores single messages")
+	flag.IntVar(&retrieval.Around, "around", 2, "number of messages of context to show either side of a message found by -rerank")
+	flag.IntVar(&graph.M, "M", 32, "maximum number of neighbours per HNSW node")
+	flag.IntVar(&graph.EfConstruction, "efc", 256, "HNSW candidate list size while indexing")
+	flag.IntVar(&graph.EfSearch, "ef", 64, "HNSW candidate list size while querying")
+	flag.IntVar(&samples, "samples", 256, "number of lenses to sample as queries in recall mode")
+	flag.StringVar(&addr, "addr", "localhost:8080", "address to serve the search API on in serve mode")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [serve | recall | convert <store> | induce <corpus>...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if err := retrieval.Mode.Valid(); err != nil {
+		panic(err)
+	}
+	if err := segments.Strategy.Valid(); err != nil {
+		panic(err)
+	}
+	segments.Drift = float32(drift)
+	if err := weighting.Scheme.Valid(); err != nil {
+		panic(err)
+	}
+	if err := weighting.Pooling.Valid(); err != nil {
+		panic(err)
+	}
+	if err := keywords.Extractor.Valid(); err != nil {
 		panic(err)
 	}
-	dms, err := client.UserChannels()
+	istrm, err := os.Open(wordpath)
 	if err != nil {
 		panic(err)
 	}
-	index := Index{Vocab: vocab}
-	indexing := sync.WaitGroup{}
-	indexing.Add(len(dms))
-	workerlk := make(Semaphore, 32)
-	fmt.Println()
-	fmt.Println("Index DMs...")
-	dmsById := make(map[string]*dgo.Channel, len(dms))
-	bar = pb.New(len(dms) * maxbytec)
-	for _, dm := range dms {
-		dmsById[dm.ID] = dm
-		workerlk.Rsrv(1)
-		go func(target *dgo.Channel) {
-			defer indexing.Done()
-			defer workerlk.Free(1)
-			bytec := 0
-			spool := &spool.T{ChID: target.ID}
-			for bytec < maxbytec {
-				lens, err := index.Hydrate(client, spool, int(docsize))
-				if err != nil {
-					if err == io.EOF {
-						bar.Add(maxbytec - bytec)
-						return
-					}
-				}
-				progress := lens.ContentLength
-				bytec += progress
-				if bytec >= maxbytec {
-					progress -= bytec - maxbytec
-				}
-				bar.Add(progress)
+	if wordfmt == FormatAuto {
+		if wordfmt, err = DetectFormat(bufio.NewReaderSize(istrm, 1<<16)); err != nil {
+			panic(err)
+		}
+		if _, err = istrm.Seek(0, os.SEEK_SET); err != nil {
+			panic(err)
+		}
+	}
+	var vocab Vocab
+	if wordfmt == FormatStore {
+		istrm.Close()
+		store, err := OpenStore(wordpath)
+		if err != nil {
+			panic(err)
+		}
+		defer store.Close()
+		vocab = store
+	} else {
+		vocab = readEmbeddings(istrm, wordfmt)
+	}
+	if flag.Arg(0) == "convert" {
+		eb, ok := vocab.(*Embeddings)
+		if !ok || flag.Arg(1) == "" {
+			flag.Usage()
+			os.Exit(2)
+		}
+		ostrm, err := os.Create(flag.Arg(1))
+		if err != nil {
+			panic(err)
+		}
+		fmt.Printf("\nWrite %s...\n", flag.Arg(1))
+		if err = WriteStore(ostrm, eb); err != nil {
+			panic(err)
+		}
+		if err = ostrm.Close(); err != nil {
+			panic(err)
+		}
+		return
+	}
+	if flag.Arg(0) == "induce" {
+		if induced == "" || flag.NArg() < 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		induce(vocab, flag.Args()[1:])
+		return
+	}
+	if induced != "" {
+		A, err := LoadInduction(induced)
+		if err != nil {
+			panic(err)
+		}
+		if r, _ := A.Dims(); r != vocab.Dim() {
+			panic(fmt.Errorf("%s fits %d dimensions, but the vocabulary has %d", induced, r, vocab.Dim()))
+		}
+		inductionMatrix = A
+	}
+	base := vocab.(Enumerable)
+	var overlay *Overlay
+	if oovcount > 0 {
+		overlay = &Overlay{Vocab: vocab, Side: side, MinCount: oovcount}
+		vocab = overlay
+	}
+	known := vocab
+	switch subword {
+	case "":
+	case "hash":
+		fmt.Println("\nHash subwords...")
+		ngrams.Grams = HashGrams(base, buckets, ngrams.MinN, ngrams.MaxN)
+	default:
+		ft, err := OpenFastText(subword)
+		if err != nil {
+			panic(err)
+		}
+		defer ft.Close()
+		if ft.Dim() != vocab.Dim() {
+			panic(fmt.Errorf("%s has %d dimensions, but the vocabulary has %d", subword, ft.Dim(), vocab.Dim()))
+		}
+		ngrams.Grams, ngrams.MinN, ngrams.MaxN = ft, ft.MinN, ft.MaxN
+	}
+	if ngrams.Grams != nil {
+		ngrams.Vocab = vocab
+		vocab = &ngrams
+	}
+	index := &Index{
+		Vocab:        vocab,
+		Retrieval:    retrieval,
+		Graph:        graph,
+		Segmentation: segments,
+		OOV:          overlay,
+		Weights:      &Weights{Weighting: weighting},
+		Keywords:     keywords,
+	}
+	var (
+		client  *dgo.Session
+		speller *SpellChker
+		stale   = true
+	)
+	if _, err = os.Stat(indexpath); indexpath != "" && err == nil {
+		fmt.Println()
+		fmt.Println("Load index...")
+		if err = index.Load(indexpath); err != nil {
+			panic(err)
+		}
+		if refresh || backfill {
+			client = session()
+			crawl(index, client)
+			index.Reweigh()
+			if err = index.Save(indexpath); err != nil {
+				panic(err)
+			}
+		}
+		stale = refresh || backfill
+	} else {
+		if importdir != "" {
+			feeds, err := Import(importdir)
+			if err != nil {
+				panic(err)
+			}
+			ingest(index, feeds)
+		} else {
+			client = session()
+			crawl(index, client)
+		}
+		index.Reweigh()
+		if indexpath != "" {
+			if err = index.Save(indexpath); err != nil {
+				panic(err)
+			}
+		}
+	}
+	// only -spell and the prompt's suggestions need the spelling model, and
+	// one saved before this crawl would be stale by the time they do
+	if spell || flag.Arg(0) == "" {
+		speller = loadSpeller(index, known, base, stale)
+	} else if stale && indexpath != "" {
+		os.Remove(spellPath(indexpath))
+	}
+	if spell {
+		index.Spell = speller
+	}
+	if live {
+		if client == nil {
+			client = session()
+		}
+		feed := &Live{
+			Index: index,
+			Width: int(docsize),
+			Filter: func(msg *dgo.Message) bool {
+				ch, err := resolve(client, msg.ChannelID)
+				return err == nil && sources.Admits(ch)
+			},
+			Resolve: func(chID string) Origin {
+				ch, err := resolve(client, chID)
 				if err != nil {
-					if err != io.EOF {
-						panic(err)
-					}
-					return
+					return Origin{ChID: chID}
 				}
-			}
-		}(dm)
+				return originOf(client, ch)
+			},
+		}
+		stop, err := feed.Listen(client, func(err error) {
+			fmt.Fprintf(os.Stderr, "live indexing: %s\n", err)
+		})
+		if err != nil {
+			panic(err)
+		}
+		defer stop()
+	}
+	if flag.Arg(0) == "recall" {
+		recall, approx, brute := index.Recall(retrieval.K, samples)
+		fmt.Printf("recall@%d over %d sampled lenses: %.3f\n", retrieval.K, samples, recall)
+		fmt.Printf("mean query time: %s hnsw (ef=%d), %s exhaustive\n",
+			approx, graph.EfSearch, brute)
+		if ranked, converged, iterations := index.KeywordConvergence(); ranked > 0 {
+			fmt.Printf("textrank converged for %d of %d lenses in %.1f iterations on average\n",
+				converged, ranked, iterations)
+		}
+		return
+	}
+	if flag.Arg(0) == "serve" {
+		mux := http.NewServeMux()
+		mux.Handle("/search", &Server{Index: index, MaxK: 100})
+		fmt.Printf("Indexing complete. Serving on %s...\n", addr)
+		panic(http.ListenAndServe(addr, mux))
 	}
-	indexing.Wait()
-	fmt.Println()
 	fmt.Printf("Indexing complete.\n> ")
 	sc := bufio.NewScanner(os.Stdin)
 	for sc.Scan() {
-		results := index.QueryBrute(sc.Text())
-		k := 8
+		q, err := ParseQuery(sc.Text())
+		if err != nil {
+			fmt.Printf("%s\n> ", err)
+			continue
+		}
+		if s := speller.Correct(q.Text); s != "" {
+			if spell {
+				fmt.Printf("Showing results for %q.\n", s)
+			} else {
+				fmt.Printf("Did you mean %q?\n", s)
+			}
+		}
+		results := index.Find(index.Retrieval, q)
+		if retrieval.Rerank > 0 && strings.TrimSpace(q.Text) != "" {
+			matches := index.Pinpoint(index.Retrieval, q.Text, results)
+			fmt.Printf("Found %d message(s):\n", len(matches))
+			for _, m := range matches {
+				fmt.Printf("%s; %s:\n", idTime(m.Message.ID).Format("Jan 02 '06 15:04:05"), m.Label())
+				for _, x := range m.Context {
+					mark := " "
+					if x.ID == m.Message.ID {
+						mark = ">"
+					}
+					fmt.Printf("  %s %s: %s\n", mark, x.Author, clip(x.Text(), 160))
+				}
+				fmt.Printf("  %s\n", m.Link(m.Message.ID))
+			}
+			fmt.Printf("> ")
+			continue
+		}
+		qv := index.VectorizeQuery(q.Text)
+		k := retrieval.K
 		if k > len(results) {
 			k = len(results)
 		}
 		results = results[:k]
 		fmt.Printf("Found %d hit(s):\n", len(results))
 		for _, r := range results {
-			recipients := []string{"nobody"}
-			if len(dmsById[r.ChID].Recipients) != 0 {
-				recipients = make([]string, 0, len(dmsById[r.ChID].Recipients))
-				for _, u := range dmsById[r.ChID].Recipients {
-					recipients = append(recipients, u.String())
-				}
-			}
-			keyphrases := make([]string, 0, 3)
-			// TODO: sort keyphrases by relevance to the query to make a kind
-			// of "highlights" system
-			for _, phrase := range r.KeyPhrases {
-				s := strings.Join(phrase.Tokens, " ")
-				s = fmt.Sprintf(`"%s"`, s)
-				keyphrases = append(keyphrases, s)
+			highlights := make([]string, 0, 3)
+			for _, hl := range index.Highlights(r.Lens, q.Text, 3) {
+				highlights = append(highlights, fmt.Sprintf(`"%s"`, hl))
 			}
 			fmt.Printf("%s; %s: %s\n",
 				r.Time.Format("Jan 02 '06 15:04:05"),
-				strings.Join(recipients, ", "),
-				strings.Join(keyphrases, ", "))
+				r.Label(),
+				strings.Join(highlights, ", "))
+			fmt.Printf("  %s\n", r.Link(r.FirstID))
+			for _, x := range index.Excerpts(r.Lens, qv, 2) {
+				fmt.Printf("  > %s: %s\n    %s\n", x.Author, clip(x.Text(), 160), r.Link(x.ID))
+			}
 		}
 		fmt.Printf("> ")
 	}
+	if live && indexpath != "" {
+		index.Reweigh()
+		if err = index.Save(indexpath); err != nil {
+			panic(err)
+		}
+	}
 }
@@ -1,13 +1,14 @@
 package main
 
 import (
+	"fmt"
 	"math"
+	"strings"
 	"unicode"
 
 	"golang.org/x/text/transform"
 	"golang.org/x/text/unicode/norm"
 	"gonum.org/v1/gonum/blas/blas32"
-	"gonum.org/v1/gonum/mat"
 )
 
 func isMn(r rune) bool {
@@ -26,10 +27,21 @@ func normalize(s string) string {
 	return s
 }
 
+// clip flattens s onto one line and cuts it to at most n runes.
+func clip(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > n {
+		s = string(r[:n-1]) + "…"
+	}
+	return s
+}
+
 type TfIdf struct {
 	tf, df       map[string]int
 	touch        map[string]struct{}
 	docs, docLen int
+	// count is the number of tokens seen in all documents.
+	count int
 }
 
 func (counter *TfIdf) Init() {
@@ -43,6 +55,7 @@ func (counter *TfIdf) Inc(t string) {
 		counter.Init()
 	}
 	counter.tf[t] += 1
+	counter.count++
 	counter.touch[t] = struct{}{}
 }
 
@@ -129,37 +142,95 @@ func (bag *BOW) Del(t string) {
 	delete(bag.Dict, bag.Sanitize(t))
 }
 
+// Pooling names how Oneshot combines the vectors it is given.
+type Pooling string
+
+const (
+	// Mean averages the vectors, ignoring their weights.
+	Mean Pooling = "mean"
+	// WeightedMean averages the vectors in proportion to their weights.
+	WeightedMean Pooling = "weighted"
+	// Max takes the greatest value of each component, ignoring weights.
+	Max Pooling = "max"
+)
+
+func (pooling Pooling) Valid() error {
+	switch pooling {
+	case Mean, WeightedMean, Max:
+		return nil
+	}
+	return fmt.Errorf("pooling %q not recognized", string(pooling))
+}
+
+// Oneshot pools a stream of vectors without keeping them: WeightedMean by
+// default, and scaled to unit length on Finalize if Normalize is set.
 type Oneshot struct {
 	Vec
+	Pooling   Pooling
+	Normalize bool
+	// SampleCount is the number of vectors added, and Weight the sum of
+	// their weights.
 	SampleCount int
+	Weight      float32
 }
 
 func (cma *Oneshot) Add(v Vec) {
+	cma.Weigh(v, 1)
+}
+
+// Weigh adds v with weight w.
+func (cma *Oneshot) Weigh(v Vec, w float32) {
 	if v == nil {
 		return
 	}
-	if cma.Vec == nil {
-		cma.Vec = make(Vec, v.Dim())
-		copy(cma.Vec, v)
-		return
+	switch cma.Pooling {
+	case Max:
+		if cma.Vec == nil {
+			cma.Vec = make(Vec, v.Dim())
+			copy(cma.Vec, v)
+		}
+		for i, x := range v {
+			if x > cma.Vec[i] {
+				cma.Vec[i] = x
+			}
+		}
+		w = 1
+	case Mean:
+		w = 1
+		fallthrough
+	default:
+		if cma.Vec == nil {
+			cma.Vec = make(Vec, v.Dim())
+		}
+		// accumulate into our own copy; v belongs to the vocabulary and is
+		// shared by every concurrent query
+		blas32.Axpy(w, v.ToBlas(), cma.Vec.ToBlas())
 	}
-	blas32.Axpy(1, cma.Vec.ToBlas(), v.ToBlas())
 	cma.SampleCount++
-	return
+	cma.Weight += w
 }
 
+// Finalize returns the pooled vector. Averages are put through the induction
+// transform, if any, before they are normalized.
 func (cma *Oneshot) Finalize() (u Vec) {
 	if cma.Vec == nil {
 		return
 	}
 	u = make(Vec, cma.Dim())
-	blas32.Scal(1/float32(cma.SampleCount), u.ToBlas())
 	copy(u, cma.Vec)
-	v := mat.NewDense(cma.Dim(), 1, nil)
-	A := inductionMatrix
-	v.Mul(A, u)
-	for i := range u {
-		u[i] = float32(v.RawMatrix().Data[i])
+	if cma.Pooling != Max {
+		if cma.Weight != 0 {
+			blas32.Scal(1/cma.Weight, u.ToBlas())
+		}
+		u = inducted(u)
+	}
+	if n := blas32.Nrm2(u.ToBlas()); cma.Normalize && n > 0 {
+		blas32.Scal(1/n, u.ToBlas())
 	}
 	return
 }
+
+// Reset empties the pool, keeping its configuration.
+func (cma *Oneshot) Reset() {
+	*cma = Oneshot{Pooling: cma.Pooling, Normalize: cma.Normalize}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func near(u, v Vec) bool {
+	if len(u) != len(v) {
+		return false
+	}
+	for i := range u {
+		if math.Abs(float64(u[i]-v[i])) > 1e-5 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestOneshot(t *testing.T) {
+	type sample struct {
+		v Vec
+		w float32
+	}
+	samples := []sample{{Vec{2, 0}, 1}, {Vec{0, 4}, 3}, {Vec{4, -2}, 0}}
+	for _, tc := range []struct {
+		pooling   Pooling
+		normalize bool
+		want      Vec
+	}{
+		{Mean, false, Vec{2, 2.0 / 3}},
+		{WeightedMean, false, Vec{0.5, 3}},
+		{"", false, Vec{0.5, 3}},
+		{Max, false, Vec{4, 4}},
+		{Mean, true, Vec{0.9486833, 0.3162278}},
+		{WeightedMean, true, Vec{0.1643990, 0.9863939}},
+		{Max, true, Vec{0.7071068, 0.7071068}},
+	} {
+		pool := Oneshot{Pooling: tc.pooling, Normalize: tc.normalize}
+		for _, s := range samples {
+			pool.Weigh(s.v, s.w)
+		}
+		pool.Weigh(nil, 1)
+		if pool.SampleCount != len(samples) {
+			t.Errorf("%s: SampleCount = %d, want %d", tc.pooling, pool.SampleCount, len(samples))
+		}
+		if got := pool.Finalize(); !near(got, tc.want) {
+			t.Errorf("%s normalize=%v: %v, want %v", tc.pooling, tc.normalize, got, tc.want)
+		}
+	}
+	var empty Oneshot
+	if empty.Finalize() != nil {
+		t.Error("empty pool is not nil")
+	}
+}
+
+// TestOneshotSampleCount checks that the first vector counts, which it once
+// did not, and that the samples it was given are left alone.
+func TestOneshotSampleCount(t *testing.T) {
+	var pool Oneshot
+	first := Vec{3, 3}
+	pool.Add(first)
+	if got := pool.Finalize(); pool.SampleCount != 1 || !near(got, Vec{3, 3}) {
+		t.Errorf("one sample: count %d, mean %v", pool.SampleCount, got)
+	}
+	pool.Add(Vec{1, 1})
+	if got := pool.Finalize(); pool.SampleCount != 2 || !near(got, Vec{2, 2}) {
+		t.Errorf("two samples: count %d, mean %v", pool.SampleCount, got)
+	}
+	if !near(first, Vec{3, 3}) {
+		t.Errorf("sample overwritten: %v", first)
+	}
+}
+
+// TestWindowLength checks that a window scores against a query the same
+// however long it is, and that query and document vectors of the same words
+// coincide, whatever the pooling.
+func TestWindowLength(t *testing.T) {
+	vocab := testVocab()
+	for _, pooling := range []Pooling{Mean, WeightedMean, Max} {
+		for _, normalize := range []bool{false, true} {
+			weights := &Weights{Weighting: Weighting{Pooling: pooling, Normalize: normalize}}
+			index := &Index{Vocab: vocab, Weights: weights}
+			prism := Prism{Vocab: vocab, Weights: weights}
+			q := index.VectorizeQuery("cat dog")
+			short := prism.embed([]Excerpt{{Content: "cat dog"}}, nil)
+			long := prism.embed([]Excerpt{{Content: strings.Repeat("cat dog ", 100)}}, nil)
+			if !near(q, short) || !near(short, long) {
+				t.Errorf("%s normalize=%v: query %v, short %v, long %v",
+					pooling, normalize, q, short, long)
+			}
+			other := prism.embed([]Excerpt{{Content: strings.Repeat("rain sunny cloudy ", 50)}}, nil)
+			if q.Sim(long) <= q.Sim(other) {
+				t.Errorf("%s normalize=%v: on-topic %.3f, off-topic %.3f",
+					pooling, normalize, q.Sim(long), q.Sim(other))
+			}
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build windows || plan9 || js
+// +build windows plan9 js
+
+package main
+
+import "io/ioutil"
+
+// mmapFile reads the whole file instead of mapping it.
+func mmapFile(path string) (data []byte, unmap func() error, err error) {
+	data, err = ioutil.ReadFile(path)
+	unmap = func() error { return nil }
+	return
+}
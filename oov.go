@@ -91,45 +91,75 @@ func (spanner *CoocSpanner) SPMI() (A *sparse.DOK) {
 	return
 }
 
-func (spanner *CoocSpanner) TextRank(e, d float64) []float64 {
-	if d < 0 || d > 1 {
-		d = 0.15
+// Convergence reports how an iterative ranking ended: after how many
+// iterations, with what squared change in the last, and whether that was
+// below the tolerance.
+type Convergence struct {
+	Iterations int
+	Residual   float64
+	Converged  bool
+}
+
+// TextRank ranks the vocabulary by PageRank over the PMI graph, following an
+// edge with probability d. It iterates until the squared change in the ranks
+// falls below e, or for at most maxIter iterations.
+func (spanner *CoocSpanner) TextRank(e, d float64, maxIter int) (ranks []float64, report Convergence) {
+	if d <= 0 || d > 1 {
+		d = 0.85
 	}
-	if e < 0 || e > 1 {
-		e = 1e-3
+	if e <= 0 || e > 1 {
+		e = 1e-6
+	}
+	if maxIter <= 0 {
+		maxIter = 100
+	}
+	n := len(spanner.Vocab)
+	if n == 0 {
+		return
 	}
 	A := spanner.PMI()
-	n, _ := A.Dims()
 	rowSums := make([]float64, n)
 	A.DoNonZero(func(i, j int, x float64) {
-		rowSums[i] += x
+		if i != j {
+			rowSums[i] += x
+		}
 	})
-	A_hat := mat.NewDense(n, n, make([]float64, n*n))
-	A.DoNonZero(func(i, j int, x float64) {
+	// M[j][i] is the probability of stepping from i to j; words without
+	// neighbours jump anywhere
+	M := mat.NewDense(n, n, nil)
+	for i := range rowSums {
 		if rowSums[i] == 0 {
-			return
+			for j := 0; j < n; j++ {
+				M.Set(j, i, 1/float64(n))
+			}
+		}
+	}
+	A.DoNonZero(func(i, j int, x float64) {
+		if i != j && rowSums[i] > 0 {
+			M.Set(j, i, x/rowSums[i])
 		}
-		A_hat.Set(i, j, x/rowSums[i])
 	})
-	A_hat.Apply(func(i, j int, x float64) float64 {
-		x *= (1 - d)
-		x += d / float64(n)
-		return x
-	}, A_hat)
-	v := mat.NewDense(n, 1, make([]float64, n))
-	v.Apply(func(i, j int, x float64) float64 {
-		return rand.Float64() / float64(n)
-	}, v)
-	for {
-		u := mat.DenseCopyOf(v)
-		v.Mul(A_hat, v)
-		u.Sub(u, v)
-		u.MulElem(u, u)
-		qerr := mat.Sum(u)
-		if qerr < e {
+	M.Apply(func(i, j int, x float64) float64 {
+		return d*x + (1-d)/float64(n)
+	}, M)
+	v, u := mat.NewVecDense(n, nil), mat.NewVecDense(n, nil)
+	for i := 0; i < n; i++ {
+		v.SetVec(i, 1/float64(n))
+	}
+	for report.Iterations < maxIter {
+		u.MulVec(M, v)
+		u, v = v, u
+		u.SubVec(u, v)
+		report.Iterations++
+		report.Residual = mat.Dot(u, u)
+		if report.Residual < e {
+			report.Converged = true
 			break
 		}
 	}
-	v.Scale(1/mat.Sum(v), v)
-	return mat.VecDenseCopyOf(v.ColView(0)).RawVector().Data
+	ranks = make([]float64, n)
+	for i := range ranks {
+		ranks[i] = v.AtVec(i)
+	}
+	return
 }
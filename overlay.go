@@ -0,0 +1,123 @@
+package main
+
+import "sync"
+
+// Overlay adds vectors for the words its Vocab lacks (server jargon,
+// nicknames, project names) induced from the contexts they occur in as the
+// index ingests them. Once a word has been seen in MinCount windows its
+// vector is the à-la-carte transform of its mean context.
+type Overlay struct {
+	Vocab
+	Side, MinCount int
+	Induced        map[string]Vec
+	Contexts       map[string]*ContextMean
+	sync.RWMutex
+	// fresh holds the words induced since the lenses were last embedded,
+	// which those mentioning them lack.
+	fresh map[string]struct{}
+}
+
+func (ov *Overlay) Embed(t string) Vec {
+	if v := ov.Vocab.Embed(t); v != nil {
+		return v
+	}
+	ov.RLock()
+	defer ov.RUnlock()
+	return ov.Induced[t]
+}
+
+// Observe collects the contexts of the out-of-vocabulary words in a run of
+// sanitized tokens and induces vectors for those now seen often enough.
+func (ov *Overlay) Observe(tokens []string) {
+	ov.Lock()
+	defer ov.Unlock()
+	if ov.Contexts == nil {
+		ov.Contexts = make(map[string]*ContextMean)
+		ov.Induced = make(map[string]Vec)
+	}
+	if ov.fresh == nil {
+		ov.fresh = make(map[string]struct{})
+	}
+	seen := make(map[string]bool)
+	for i, t := range tokens {
+		if ov.Vocab.Embed(t) != nil {
+			continue
+		}
+		lo, hi := i-ov.Side, i+ov.Side+1
+		if lo < 0 {
+			lo = 0
+		}
+		if hi > len(tokens) {
+			hi = len(tokens)
+		}
+		ctx, ok := ov.Contexts[t]
+		if !ok {
+			ctx = &ContextMean{}
+			ov.Contexts[t] = ctx
+		}
+		ctx.Add(ov.Vocab, tokens[lo:hi], i-lo)
+		seen[t] = true
+	}
+	for t := range seen {
+		ov.induce(t)
+	}
+}
+
+func (ov *Overlay) induce(t string) {
+	ctx := ov.Contexts[t]
+	if ctx.Windows < ov.MinCount {
+		return
+	}
+	if u := ctx.Mean(); u != nil {
+		if _, ok := ov.Induced[t]; !ok {
+			ov.fresh[t] = struct{}{}
+		}
+		ov.Induced[t] = inducted(u)
+	}
+}
+
+// Restore replaces the collected contexts, as read from a snapshot, and
+// induces vectors from them afresh. Of those, the ones not embedded are
+// fresh.
+func (ov *Overlay) Restore(contexts map[string]*ContextMean, embedded []string) {
+	ov.Lock()
+	defer ov.Unlock()
+	ov.Contexts = contexts
+	ov.Induced = make(map[string]Vec)
+	ov.fresh = make(map[string]struct{})
+	if ov.Contexts == nil {
+		ov.Contexts = make(map[string]*ContextMean)
+	}
+	for t := range ov.Contexts {
+		ov.induce(t)
+	}
+	for _, t := range embedded {
+		delete(ov.fresh, t)
+	}
+}
+
+// Fresh returns the words induced since it was last called.
+func (ov *Overlay) Fresh() (words map[string]struct{}) {
+	ov.Lock()
+	defer ov.Unlock()
+	words, ov.fresh = ov.fresh, make(map[string]struct{})
+	return
+}
+
+// embedded lists the induced words that are not fresh. The caller holds at
+// least a read lock.
+func (ov *Overlay) embedded() (words []string) {
+	for t := range ov.Induced {
+		if _, ok := ov.fresh[t]; !ok {
+			words = append(words, t)
+		}
+	}
+	return
+}
+
+// tokens lexes s the way documents are lexed for embedding.
+func tokens(s string) []string {
+	lexer := &Collector{Sanitizer: SanitizerChain{StripPunct, ToLower}}
+	EmbedPolicy.Lex(lexer, s)
+	return lexer.Tokens
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestOverlayReembed checks that lenses indexed before a word was induced
+// are embedded again with it, and that a snapshot remembers they were.
+func TestOverlayReembed(t *testing.T) {
+	overlay := &Overlay{Vocab: testVocab(), Side: 2, MinCount: 2}
+	index := &Index{Vocab: overlay, OOV: overlay}
+	var lenses []*Lens
+	for i, chID := range []string{"1", "2"} {
+		feed := Feed{Origin{ChID: chID}, &Replay{Messages: testMessages(chID, 2*i, "zorp rain sunny", "cat dog pet cat dog")}}
+		lens, err := index.Hydrate(feed, 512)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lenses = append(lenses, lens)
+	}
+	if overlay.Embed("zorp") == nil {
+		t.Fatal("zorp not induced")
+	}
+	before := append(Vec(nil), lenses[0].Vec...)
+	index.Reweigh()
+	want := (&Prism{Vocab: overlay}).embed(lenses[0].Messages, lenses[0].KeyWords)
+	if near(lenses[0].Vec, before) || !near(lenses[0].Vec, want) {
+		t.Errorf("lens not embedded again: was %v, is %v, want %v", before, lenses[0].Vec, want)
+	}
+
+	dir, err := ioutil.TempDir("", "index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "index")
+	if err = index.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	reload := &Overlay{Vocab: testVocab(), Side: 2, MinCount: 2}
+	if err = (&Index{Vocab: reload, OOV: reload}).Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if fresh := reload.Fresh(); len(fresh) != 0 {
+		t.Errorf("embedded words fresh again after loading: %v", fresh)
+	}
+}
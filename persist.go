@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/gob"
+	"fmt"
+	"os"
+
+	"github.com/Bithack/go-hnsw"
+	"github.com/Bithack/go-hnsw/f32"
+)
+
+// snapshotVersion is bumped whenever the layout of snapshot changes in a way
+// that older readers cannot decode.
+const snapshotVersion = 8
+
+// snapshot is the on-disk form of an Index. The HNSW graph is not gob-encoded
+// alongside it; go-hnsw writes its own format to graphPath(path).
+type snapshot struct {
+	Version int
+	Dim     int
+	Ledgerc int
+	Ledger  map[uint32]*Lens
+	Cursors map[string]*Cursor
+	// Contexts are those collected by the index's Overlay, from which its
+	// vectors are induced again on load, and Embedded the induced words the
+	// lenses were embedded with.
+	Contexts map[string]*ContextMean
+	Embedded []string
+	// Weighting is what the vectors were weighed with, and PC the common
+	// component removed from them.
+	Weighting Weighting
+	PC        Vec
+}
+
+func graphPath(path string) string {
+	return path + ".hnsw"
+}
+
+func (index *Index) Save(path string) (err error) {
+	index.RLock()
+	defer index.RUnlock()
+	ostrm, err := os.Create(path)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if cerr := ostrm.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	snap := snapshot{
+		Version: snapshotVersion,
+		Dim:     index.Dim(),
+		Ledgerc: index.ledgerc,
+		Ledger:  index.qledger,
+		Cursors: index.cursors,
+	}
+	if index.OOV != nil {
+		index.OOV.RLock()
+		defer index.OOV.RUnlock()
+		snap.Contexts = index.OOV.Contexts
+		snap.Embedded = index.OOV.embedded()
+	}
+	if index.Weights != nil {
+		index.Weights.RLock()
+		defer index.Weights.RUnlock()
+		snap.Weighting, snap.PC = index.Weights.Weighting, index.Weights.PC
+	}
+	if err = gob.NewEncoder(ostrm).Encode(&snap); err != nil {
+		return
+	}
+	// an index with no lenses yet has no graph, only cursors, and a graph
+	// left over from an earlier save is not read back with an empty ledger
+	if index.cluster != nil {
+		err = index.cluster.Save(graphPath(path))
+	}
+	return
+}
+
+func (index *Index) Load(path string) (err error) {
+	istrm, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer istrm.Close()
+	snap := snapshot{}
+	if err = gob.NewDecoder(istrm).Decode(&snap); err != nil {
+		return
+	}
+	if snap.Version != snapshotVersion {
+		err = fmt.Errorf("load %s: snapshot version %d, want %d",
+			path, snap.Version, snapshotVersion)
+		return
+	}
+	if snap.Dim != index.Dim() {
+		err = fmt.Errorf("load %s: snapshot has %d dimensions, vocabulary has %d",
+			path, snap.Dim, index.Dim())
+		return
+	}
+	// the graph is left nil for an empty ledger, for add to build
+	var cluster *hnsw.Hnsw
+	if len(snap.Ledger) > 0 {
+		if cluster, _, err = hnsw.Load(graphPath(path)); err != nil {
+			return
+		}
+		if snap.Ledgerc < len(snap.Ledger) {
+			snap.Ledgerc = len(snap.Ledger)
+		}
+		// the distance is not saved with the graph
+		cluster.DistFunc = f32.L2Squared
+		cluster.Grow(snap.Ledgerc)
+	}
+	if index.OOV != nil {
+		index.OOV.Restore(snap.Contexts, snap.Embedded)
+	}
+	index.Lock()
+	index.cluster = cluster
+	index.qledger = snap.Ledger
+	index.ledgerc = snap.Ledgerc
+	index.cursors = snap.Cursors
+	// the lexical index is cheap to rebuild from the lenses' messages
+	index.lexicon = BM25{K1: index.lexicon.K1, B: index.lexicon.B}
+	for id, lens := range snap.Ledger {
+		index.lexicon.Add(id, lens.terms())
+	}
+	// the weights are tabulated from the lexical index too, but vectors
+	// weighed otherwise than configured have to be embedded again, as do
+	// those lacking words induced since they were
+	if weights := index.Weights; weights != nil && weights.Weighting != snap.Weighting {
+		index.reweigh()
+	} else {
+		if weights != nil {
+			weights.tabulate(&index.lexicon.TfIdf)
+			weights.Lock()
+			weights.PC = snap.PC
+			weights.Unlock()
+		}
+		index.reembedFresh()
+	}
+	index.Unlock()
+	return
+}
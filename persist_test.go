@@ -0,0 +1,38 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestSaveEmpty checks that an index with cursors but no lenses round-trips,
+// and that lenses can be added to it once loaded.
+func TestSaveEmpty(t *testing.T) {
+	dir, err := ioutil.TempDir("", "index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "index")
+	index := &Index{Vocab: testVocab()}
+	index.cursors = map[string]*Cursor{"1": {}}
+	if err = index.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded := &Index{Vocab: testVocab()}
+	if err = loaded.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := loaded.cursors["1"]; !ok {
+		t.Error("cursor lost")
+	}
+	feed := Feed{Origin{ChID: "1"}, &Replay{Messages: testMessages("1", 1, "cat dog", "pet cat")}}
+	if _, err = loaded.Hydrate(feed, 512); err != nil {
+		t.Fatal(err)
+	}
+	if results := loaded.Query("cat", 1); len(results) != 1 {
+		t.Errorf("%d results after hydrating a loaded empty index", len(results))
+	}
+}
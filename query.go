@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/kavorite/discord-snowflake"
+)
+
+// Query is a parsed search. Its operators become filters over lens metadata
+// and Text is what remains for the embedder:
+//
+//	from:user in:channel before:2020-05-01 after:2020-01-01
+//	"exact phrase" -excluded -"excluded phrase"
+//
+// Operator values may be quoted to include spaces.
+type Query struct {
+	Text          string
+	From, In      []string
+	Before, After time.Time
+	Phrases       []string
+	Exclude       []string
+}
+
+// splitQuery breaks s on whitespace outside of double quotes.
+func splitQuery(s string) (fields []string, err error) {
+	var (
+		field  strings.Builder
+		quoted bool
+	)
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			field.WriteRune(r)
+		case unicode.IsSpace(r) && !quoted:
+			if field.Len() > 0 {
+				fields = append(fields, field.String())
+				field.Reset()
+			}
+		default:
+			field.WriteRune(r)
+		}
+	}
+	if quoted {
+		err = fmt.Errorf("unterminated quote in %q", s)
+		return
+	}
+	if field.Len() > 0 {
+		fields = append(fields, field.String())
+	}
+	return
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// excluded reports whether field excludes a word or a quoted phrase, unlike a
+// negative number.
+func excluded(field string) bool {
+	if len(field) < 2 || field[0] != '-' {
+		return false
+	}
+	r := []rune(field[1:])[0]
+	return r == '"' || unicode.IsLetter(r)
+}
+
+func ParseQuery(s string) (q Query, err error) {
+	fields, err := splitQuery(s)
+	if err != nil {
+		return
+	}
+	text := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if strings.HasPrefix(field, `"`) {
+			phrase := unquote(field)
+			q.Phrases = append(q.Phrases, phrase)
+			text = append(text, phrase)
+			continue
+		}
+		if excluded(field) {
+			q.Exclude = append(q.Exclude, unquote(field[1:]))
+			continue
+		}
+		i := strings.IndexByte(field, ':')
+		if i < 0 {
+			text = append(text, field)
+			continue
+		}
+		op, arg := strings.ToLower(field[:i]), unquote(field[i+1:])
+		switch op {
+		case "from":
+			q.From = append(q.From, arg)
+		case "in":
+			q.In = append(q.In, arg)
+		case "before", "after":
+			var t time.Time
+			if t, err = parseTime(arg); err != nil {
+				err = fmt.Errorf("%s: %q is not a date", op, arg)
+				return
+			}
+			if op == "before" {
+				q.Before = t
+			} else {
+				q.After = t
+			}
+		default:
+			// not an operator; URLs and times land here
+			text = append(text, field)
+		}
+	}
+	q.Text = strings.Join(text, " ")
+	return
+}
+
+// sameUser compares a user filter against a "name#discriminator" string,
+// ignoring case and an omitted discriminator.
+func sameUser(filter, user string) bool {
+	if strings.EqualFold(filter, user) {
+		return true
+	}
+	if i := strings.LastIndexByte(user, '#'); i >= 0 {
+		return strings.EqualFold(filter, user[:i])
+	}
+	return false
+}
+
+func idTime(id string) time.Time {
+	flake, _ := snowflake.Parse(id)
+	return flake.Time()
+}
+
+// normPhrase lowercases s and collapses its runs of whitespace, for matching
+// phrases against messages.
+func normPhrase(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+// hasPhrase reports whether any message of the lens contains phrase, as
+// normalized by normPhrase.
+func (lens *Lens) hasPhrase(phrase string) bool {
+	for _, msg := range lens.Messages {
+		if strings.Contains(normPhrase(msg.Text()), phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+// Filters translates the query's operators into filters over lenses, all
+// but its exclusions, which Index.Find looks up in the lexical index.
+func (q Query) Filters() (filters []Filter) {
+	if len(q.From) > 0 {
+		filters = append(filters, func(lens *Lens) bool {
+			for _, user := range q.From {
+				for _, msg := range lens.Messages {
+					if sameUser(user, msg.Author) {
+						return true
+					}
+				}
+			}
+			return false
+		})
+	}
+	if len(q.In) > 0 {
+		filters = append(filters, func(lens *Lens) bool {
+			for _, ch := range q.In {
+				ch = strings.TrimPrefix(ch, "#")
+				if ch == lens.ChID || strings.EqualFold(ch, lens.Name) || strings.EqualFold(ch, lens.Guild) {
+					return true
+				}
+				for _, user := range lens.Recipients {
+					if sameUser(ch, user) {
+						return true
+					}
+				}
+			}
+			return false
+		})
+	}
+	if !q.Before.IsZero() {
+		filters = append(filters, func(lens *Lens) bool {
+			return idTime(lens.FirstID).Before(q.Before)
+		})
+	}
+	if !q.After.IsZero() {
+		filters = append(filters, func(lens *Lens) bool {
+			return idTime(lens.LastID).After(q.After)
+		})
+	}
+	if len(q.Phrases) > 0 {
+		phrases := make([]string, len(q.Phrases))
+		for i, phrase := range q.Phrases {
+			phrases[i] = normPhrase(phrase)
+		}
+		filters = append(filters, func(lens *Lens) bool {
+			for _, phrase := range phrases {
+				if !lens.hasPhrase(phrase) {
+					return false
+				}
+			}
+			return true
+		})
+	}
+	return
+}
+
+// exclusion returns a filter rejecting the lenses that contain any of terms,
+// each a word or a phrase. Lenses are looked up in the lexical index by the
+// words of each term, and only those holding all of a phrase's words are
+// searched for it.
+func (index *Index) exclusion(terms []string) Filter {
+	index.RLock()
+	defer index.RUnlock()
+	excluded := make(map[*Lens]struct{})
+	for _, term := range terms {
+		lexer := Collector{Sanitizer: SanitizerChain{StripPunct, ToLower}}
+		IndexPolicy.Lex(&lexer, term)
+		if len(lexer.Tokens) == 0 {
+			continue
+		}
+		phrase := normPhrase(term)
+	candidates:
+		for id := range index.lexicon.postings[lexer.Tokens[0]] {
+			for _, t := range lexer.Tokens[1:] {
+				if index.lexicon.postings[t][id] == 0 {
+					continue candidates
+				}
+			}
+			lens := index.qledger[id]
+			if len(lexer.Tokens) == 1 || lens.hasPhrase(phrase) {
+				excluded[lens] = struct{}{}
+			}
+		}
+	}
+	return func(lens *Lens) bool {
+		_, ok := excluded[lens]
+		return !ok
+	}
+}
+
+// Find runs a parsed query under cfg. A query made only of operators lists
+// the lenses they admit, newest first.
+func (index *Index) Find(cfg Retrieval, q Query, filters ...Filter) (results []Result) {
+	filters = append(filters, q.Filters()...)
+	if len(q.Exclude) > 0 {
+		filters = append(filters, index.exclusion(q.Exclude))
+	}
+	if strings.TrimSpace(q.Text) != "" {
+		return index.SearchWith(cfg, q.Text, filters...)
+	}
+	index.RLock()
+	defer index.RUnlock()
+	for _, lens := range index.qledger {
+		if admits(filters, lens) {
+			results = append(results, Result{lens, 0})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Time.After(results[j].Time)
+	})
+	return
+}
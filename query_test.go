@@ -0,0 +1,91 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestParseQuery(t *testing.T) {
+	day := func(s string) time.Time {
+		t, _ := time.Parse("2006-01-02", s)
+		return t
+	}
+	for _, tc := range []struct {
+		in   string
+		want Query
+		err  bool
+	}{
+		{in: "cat dog", want: Query{Text: "cat dog"}},
+		{in: "From:ann in:#general cat", want: Query{Text: "cat", From: []string{"ann"}, In: []string{"#general"}}},
+		{in: `in:"off topic" from:ann from:bob`, want: Query{From: []string{"ann", "bob"}, In: []string{"off topic"}}},
+		{in: "before:2020-05-01 after:2020-01-01T12:00:00Z rain",
+			want: Query{Text: "rain", Before: day("2020-05-01"), After: day("2020-01-01").Add(12 * time.Hour)}},
+		{in: "before:yesterday", err: true},
+		{in: `after:"2020-01"`, err: true},
+		{in: `"sunny  day" cat`, want: Query{Text: "sunny  day cat", Phrases: []string{"sunny  day"}}},
+		{in: `"unterminated cat`, err: true},
+		{in: `cat -dog -"rainy day"`, want: Query{Text: "cat", Exclude: []string{"dog", "rainy day"}}},
+		{in: "-5 degrees - cat --", want: Query{Text: "-5 degrees - cat --"}},
+		{in: "https://example.com/a 10:30", want: Query{Text: "https://example.com/a 10:30"}},
+	} {
+		q, err := ParseQuery(tc.in)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%q: no error", tc.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %s", tc.in, err)
+		} else if !reflect.DeepEqual(q, tc.want) {
+			t.Errorf("%q: %+v, want %+v", tc.in, q, tc.want)
+		}
+	}
+}
+
+// TestFind checks the filters a query's operators make against a small
+// index of one lens per channel.
+func TestFind(t *testing.T) {
+	index := &Index{Vocab: testVocab()}
+	for i, content := range []string{"cat dog", "the rainy day was cloudy", "rainy cats, sunny day", "pet -5 degrees"} {
+		chID := string('1' + rune(i))
+		msgs := testMessages(chID, 60*24*i, content)
+		msgs[0].Author.Username = []string{"ann", "bob", "ann", "cy"}[i]
+		feed := Feed{Origin{ChID: chID, Guild: "home", Name: "ch" + chID}, &Replay{Messages: msgs}}
+		if _, err := index.Hydrate(feed, 512); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tc := range []struct {
+		q    string
+		want []string
+	}{
+		{"from:ANN", []string{"1", "3"}},
+		{"from:ann#0001 in:#CH3", []string{"3"}},
+		{"in:home from:bob", []string{"2"}},
+		{`"was  CLOUDY"`, []string{"2"}},
+		{"-day", []string{"1", "4"}},
+		{`-"rainy day"`, []string{"1", "3", "4"}},
+		{`-"day rainy"`, []string{"1", "2", "3", "4"}},
+		{"-rainy -cat", []string{"4"}},
+		{`"pet -5"`, []string{"4"}},
+		{"after:" + idTime(testMessages("", 60*24, "")[0].ID).Format(time.RFC3339), []string{"3", "4"}},
+		{"before:" + idTime(testMessages("", 60*24, "")[0].ID).Format(time.RFC3339), []string{"1"}},
+	} {
+		q, err := ParseQuery(tc.q)
+		if err != nil {
+			t.Fatalf("%q: %s", tc.q, err)
+		}
+		results := index.Find(index.Retrieval, q)
+		got := make([]string, len(results))
+		for i, r := range results {
+			got[i] = r.ChID
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: %v, want %v", tc.q, got, tc.want)
+		}
+	}
+}
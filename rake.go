@@ -1,11 +1,6 @@
 package main
 
-import (
-	"github.com/jdkato/prose/v2"
-	"sort"
-
-	snowball "github.com/kljensen/snowball/english"
-)
+import "strings"
 
 // NLTK-generated list of stop-words
 var stops = []string{
@@ -32,143 +27,32 @@ var stops = []string{
 	"weren", "weren't", "won", "won't", "wouldn", "wouldn't",
 }
 
+// RAKE scores words by the ratio of their degree, the total length of the
+// candidate phrases they occur in, to their frequency, and phrases by the
+// sum of their words' scores.
 type RAKE struct {
-	*CoocSpanner
-	Stops       BOW
-	Phrases     [][]string
-	phrases     [][]string
-	phrase      []string
-	unstem      []string
-	initialized bool
-	ngc         int
-}
-
-func (tr *RAKE) Doc() {
-	if len(tr.unstem) == 0 {
-		return
-	}
-	tr.phrase = make([]string, 0, 8)
-	tr.unstem = make([]string, 0, 8)
-}
-
-func (tr *RAKE) Advance(t string) bool {
-	t = tr.CoocSpanner.Sanitize(t)
-	if t == "" {
-		return true
-	}
-	if !tr.CoocSpanner.Advance(t) {
-		return false
-	}
-	if len(tr.phrase) == tr.ngc || tr.Stops.Has(t) {
-		tr.Doc()
-		return true
-	}
-	st := snowball.Stem(normalize(t), false)
-	if st == "" {
-		return true
-	}
-	if len(tr.phrase) > 0 {
-		tr.phrase = append(tr.phrase, st)
-		tr.unstem = append(tr.unstem, t)
-	}
-	if len(tr.Context) < 3 {
-		return true
-	}
-	// add adjoint phrases
-	l, t, r := tr.Context[0], tr.Context[1], tr.Context[2]
-	if tr.Stops.Has(l) || tr.Stops.Has(r) {
-		return true
-	}
-	tr.Phrases = append(tr.Phrases, []string{l, t, r})
-	lst := snowball.Stem(l, false)
-	tst := snowball.Stem(t, false)
-	rst := snowball.Stem(r, false)
-	tr.phrases = append(tr.phrases, []string{lst, tst, rst})
-	return true
-}
-
-func (tr *RAKE) Init(ngc, size int) {
-	if tr.initialized {
-		return
-	}
-	if size < 1 {
-		size = 1024
-	}
-	if ngc < 2 {
-		ngc = 5
-	}
-	tr.ngc = ngc
-	tr.CoocSpanner = NewCoocSpanner(ngc, size,
-		&PassLex{SanitizerChain{StripPunct, ToLower}})
-	tr.Phrases = make([][]string, 0, size)
-	tr.phrases = make([][]string, 0, size)
-	stops := make([]string, len(nltkStops))
-	for i, t := range nltkStops {
-		stops[i] = snowball.Stem(t, false)
-	}
-	tr.Stops = Bag(append(stops, nltkStops...)...)
-}
-
-func (tr *RAKE) Ingest(ngc int, src string) {
-	tr.Init(ngc, 1024)
-	// break on candidate phrases
-	// Lex(tr, src)
-	doc, _ := prose.NewDocument(src,
-		prose.WithTagging(false),
-		prose.WithExtraction(false))
-	sents := doc.Sentences()
-	if len(sents) > 1 {
-		for _, sent := range sents {
-			tr.Ingest(ngc, sent.Text)
-		}
-	} else {
-		for _, t := range doc.Tokens() {
-			tr.Advance(t.Text)
-		}
-	}
-}
-
-type ScoredPhrase struct {
-	Weight float64
-	Tokens []string
+	passage
 }
 
 func (tr *RAKE) Finalize() (tokens, phrases []ScoredPhrase) {
-	A := tr.CoocSpanner.PMI()
-	m, n := A.Dims()
-	if m != n || n == 0 {
-		return
-	}
-	A_hat := A.ToDense()
-	R := make([]float64, n)
-	for i := range R {
-		for j := range R {
-			if j == i {
-				continue
-			}
-			R[i] += A_hat.At(i, j)
+	deg, freq := make(Counter), make(Counter)
+	seen := make(map[string][]string)
+	tr.candidates(func(_ int, phrase []string) {
+		for _, t := range phrase {
+			deg.Inc(t, float64(len(phrase)))
+			freq.Inc(t, 1)
 		}
-	}
-	// R := tr.CoocSpanner.TextRank(1e-3, 0.5)
-	// n := len(R)
-	tokens = make([]ScoredPhrase, n)
-	phrases = make([]ScoredPhrase, len(tr.Phrases))
-	for i := range tr.Phrases {
-		score := float64(0)
-		for _, stem := range tr.phrases[i] {
-			score += R[tr.Dict[stem]]
+		seen[strings.Join(phrase, " ")] = phrase
+	})
+	scores, words := make(map[string]float64, len(freq)), make(map[string][]string, len(freq))
+	for t := range freq {
+		scores[t], words[t] = deg[t]/freq[t], []string{t}
+	}
+	pscores := make(map[string]float64, len(seen))
+	for k, phrase := range seen {
+		for _, t := range phrase {
+			pscores[k] += scores[t]
 		}
-		score /= float64(len(tr.Phrases[i]))
-		phrases[i] = ScoredPhrase{score, tr.Phrases[i]}
-	}
-	for t, i := range tr.Dict {
-		tokens[i] = ScoredPhrase{R[i], []string{t}}
 	}
-	sort.Slice(tokens, func(i, j int) bool {
-		return tokens[i].Weight > tokens[j].Weight
-	})
-	sort.Slice(phrases, func(i, j int) bool {
-		return phrases[i].Weight > phrases[j].Weight
-	})
-	return
+	return ranked(scores, words), ranked(pscores, seen)
 }
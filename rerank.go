@@ -0,0 +1,80 @@
+package main
+
+import "sort"
+
+// Match is a single message found by reranking the messages of the best
+// lenses, quoted with those around it.
+type Match struct {
+	*Lens
+	Message Excerpt
+	Score   float32
+	// Context holds Message and the messages either side of it in
+	// chronological order.
+	Context []Excerpt
+}
+
+// Pinpoint is the second stage of a search: it ranks the messages of the
+// first cfg.Rerank results by RerankAlpha times their similarity to the query
+// plus 1-RerankAlpha times the share of the query's terms they contain, and
+// returns the best cfg.K of them with cfg.Around messages of context either
+// side.
+func (index *Index) Pinpoint(cfg Retrieval, q string, results []Result) (matches []Match) {
+	v := index.VectorizeQuery(q)
+	lexer := Collector{Sanitizer: SanitizerChain{StripPunct, ToLower}}
+	IndexPolicy.Lex(&lexer, q)
+	qterms := make(map[string]struct{}, len(lexer.Tokens))
+	for _, t := range lexer.Tokens {
+		qterms[t] = struct{}{}
+	}
+	if len(results) > cfg.Rerank {
+		results = results[:cfg.Rerank]
+	}
+	for _, r := range results {
+		for i, msg := range r.Messages {
+			var sim, overlap float32
+			if v != nil && msg.Vec != nil {
+				sim = v.Sim(msg.Vec)
+			}
+			if len(qterms) > 0 {
+				mlexer := Collector{Sanitizer: SanitizerChain{StripPunct, ToLower}}
+				IndexPolicy.Lex(&mlexer, msg.Content)
+				seen := make(map[string]struct{}, len(qterms))
+				for _, t := range mlexer.Tokens {
+					if _, ok := qterms[t]; ok {
+						seen[t] = struct{}{}
+					}
+				}
+				overlap = float32(len(seen)) / float32(len(qterms))
+			}
+			score := float32(cfg.RerankAlpha)*sim + float32(1-cfg.RerankAlpha)*overlap
+			if score <= 0 {
+				continue
+			}
+			lo, hi := i-cfg.Around, i+cfg.Around+1
+			if lo < 0 {
+				lo = 0
+			}
+			if hi > len(r.Messages) {
+				hi = len(r.Messages)
+			}
+			matches = append(matches, Match{r.Lens, msg, score, r.Messages[lo:hi]})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+	// a message can be in several overlapping windows
+	seen := make(map[string]struct{}, len(matches))
+	unique := matches[:0]
+	for _, m := range matches {
+		if _, ok := seen[m.Message.ID]; ok {
+			continue
+		}
+		seen[m.Message.ID] = struct{}{}
+		unique = append(unique, m)
+		if len(unique) == cfg.K {
+			break
+		}
+	}
+	return unique
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	dgo "github.com/bwmarrin/discordgo"
+)
+
+// Strategy names a way of cutting a channel's history into windows. Every
+// strategy closes a window once it holds Width embedded tokens; all but Fixed
+// may also close it sooner.
+type Strategy string
+
+const (
+	// Fixed windows are Width tokens long.
+	Fixed Strategy = "fixed"
+	// Gap windows also end at a silence of at least Gap.
+	Gap Strategy = "gap"
+	// Sliding windows are Width tokens long, each starting Stride tokens
+	// into the last, so that they overlap.
+	Sliding Strategy = "sliding"
+	// Topic windows also end where the cosine distance between consecutive
+	// messages exceeds Drift.
+	Topic Strategy = "topic"
+)
+
+func (strategy Strategy) Valid() error {
+	switch strategy {
+	case Fixed, Gap, Sliding, Topic:
+		return nil
+	}
+	return fmt.Errorf("segmentation strategy %q not recognized", string(strategy))
+}
+
+// Segmentation configures how Prism.Slide windows a channel. Zero values take
+// the defaults; MinWidth is the number of tokens a window must hold before a
+// gap or a topic shift may end it, and none by default.
+type Segmentation struct {
+	Strategy Strategy
+	Gap      time.Duration
+	Stride   int
+	Drift    float32
+	MinWidth int
+}
+
+func (seg Segmentation) withDefaults(width int) Segmentation {
+	if seg.Strategy == "" {
+		seg.Strategy = Fixed
+	}
+	if seg.Gap <= 0 {
+		seg.Gap = 30 * time.Minute
+	}
+	if seg.Stride <= 0 {
+		seg.Stride = width / 2
+	}
+	if seg.Drift <= 0 {
+		seg.Drift = 0.8
+	}
+	return seg
+}
+
+// breaks reports whether a window holding n tokens and ending in prev, whose
+// vector is u, should close before msg, whose vector is v.
+func (seg Segmentation) breaks(n int, prev, msg *dgo.Message, u, v Vec) bool {
+	if n < seg.MinWidth {
+		return false
+	}
+	switch seg.Strategy {
+	case Gap:
+		gap := idTime(msg.ID).Sub(idTime(prev.ID))
+		if gap < 0 {
+			gap = -gap
+		}
+		return gap >= seg.Gap
+	case Topic:
+		return u != nil && v != nil && 1-u.Sim(v) > seg.Drift
+	}
+	return false
+}
+
+// sample embeds a single message as weighed by weights, returning its vector
+// and the number of its tokens that have one.
+func sample(vocab Vocab, weights *Weights, content string) (v Vec, n int) {
+	lexer := Collector{Sanitizer: SanitizerChain{StripPunct, ToLower}}
+	EmbedPolicy.Lex(&lexer, content)
+	mean := weights.pool()
+	for _, t := range lexer.Tokens {
+		if u := vocab.Embed(t); u != nil {
+			mean.Weigh(u, weights.Weight(t))
+			n++
+		}
+	}
+	v = weights.Project(mean.Finalize())
+	return
+}
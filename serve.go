@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Hit is the JSON form of a Result.
+type Hit struct {
+	Time       time.Time `json:"time"`
+	ChID       string    `json:"channel_id"`
+	GuildID    string    `json:"guild_id,omitempty"`
+	Guild      string    `json:"guild,omitempty"`
+	Channel    string    `json:"channel,omitempty"`
+	Recipients []string  `json:"recipients"`
+	KeyPhrases []string  `json:"key_phrases"`
+	Highlights []string  `json:"highlights"`
+	Distance   float32   `json:"distance"`
+	Link       string    `json:"link"`
+	Excerpts   []Quote   `json:"excerpts"`
+	// Message and Score are set for messages found by reranking; Excerpts
+	// then holds the message's context.
+	Message *Quote  `json:"message,omitempty"`
+	Score   float32 `json:"score,omitempty"`
+}
+
+// Quote is the JSON form of an Excerpt.
+type Quote struct {
+	ID      string `json:"id"`
+	Author  string `json:"author"`
+	Content string `json:"content"`
+	Link    string `json:"link"`
+}
+
+func hitOf(r Result, highlights []Highlight, excerpts []Excerpt) Hit {
+	marked := make([]string, len(highlights))
+	for i, hl := range highlights {
+		marked[i] = hl.String()
+	}
+	quotes := make([]Quote, len(excerpts))
+	for i, x := range excerpts {
+		quotes[i] = Quote{x.ID, x.Author, x.Text(), r.Link(x.ID)}
+	}
+	keyphrases := make([]string, 0, len(r.KeyPhrases))
+	for _, phrase := range r.KeyPhrases {
+		keyphrases = append(keyphrases, strings.Join(phrase.Tokens, " "))
+	}
+	return Hit{
+		Time:       r.Time,
+		ChID:       r.ChID,
+		GuildID:    r.GuildID,
+		Guild:      r.Guild,
+		Channel:    r.Name,
+		Recipients: r.Recipients,
+		KeyPhrases: keyphrases,
+		Highlights: marked,
+		Distance:   r.Distance,
+		Link:       r.Link(r.FirstID),
+		Excerpts:   quotes,
+	}
+}
+
+func hitOfMatch(m Match) Hit {
+	hit := hitOf(Result{Lens: m.Lens}, nil, m.Context)
+	hit.Message = &Quote{m.Message.ID, m.Message.Author, m.Message.Text(), m.Link(m.Message.ID)}
+	hit.Link, hit.Score = hit.Message.Link, m.Score
+	return hit
+}
+
+// parseTime accepts either a bare date or an RFC 3339 timestamp.
+func parseTime(s string) (t time.Time, err error) {
+	if t, err = time.Parse("2006-01-02", s); err == nil {
+		return
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// Server answers search requests over HTTP. Queries only take read locks on
+// the Index, so any number of them may run at once, including alongside live
+// indexing.
+type Server struct {
+	*Index
+	MaxK int
+}
+
+type searchResponse struct {
+	Query string `json:"query"`
+	Hits  []Hit  `json:"hits"`
+}
+
+type searchError struct {
+	Error string `json:"error"`
+}
+
+func (srv *Server) fail(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(searchError{err.Error()})
+}
+
+// ServeHTTP handles GET /search?q=...&k=...&ch=...&after=...&before=...,
+// where q may use the operators ParseQuery understands, and ch may be
+// repeated and names a channel as the in: operator does.
+// mode overrides the index's retrieval mode, and approx=1 ranks semantically
+// through the HNSW graph instead of exhaustively. rerank=n finds single
+// messages within the best n windows, with around=n messages of context.
+func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		srv.fail(w, http.StatusMethodNotAllowed, fmt.Errorf("%s not allowed", r.Method))
+		return
+	}
+	params := r.URL.Query()
+	if params.Get("q") == "" {
+		srv.fail(w, http.StatusBadRequest, fmt.Errorf("missing q"))
+		return
+	}
+	q, err := ParseQuery(params.Get("q"))
+	if err != nil {
+		srv.fail(w, http.StatusBadRequest, err)
+		return
+	}
+	k := 8
+	if s := params.Get("k"); s != "" {
+		var err error
+		if k, err = strconv.Atoi(s); err != nil || k < 1 {
+			srv.fail(w, http.StatusBadRequest, fmt.Errorf("bad k: %q", s))
+			return
+		}
+	}
+	if srv.MaxK > 0 && k > srv.MaxK {
+		k = srv.MaxK
+	}
+	// ch matches channels the way the in: operator does
+	filters := Query{In: params["ch"]}.Filters()
+	for _, bound := range []string{"after", "before"} {
+		s := params.Get(bound)
+		if s == "" {
+			continue
+		}
+		t, err := parseTime(s)
+		if err != nil {
+			srv.fail(w, http.StatusBadRequest, fmt.Errorf("bad %s: %q", bound, s))
+			return
+		}
+		if bound == "after" {
+			filters = append(filters, func(lens *Lens) bool {
+				return idTime(lens.LastID).After(t)
+			})
+		} else {
+			filters = append(filters, func(lens *Lens) bool {
+				return idTime(lens.FirstID).Before(t)
+			})
+		}
+	}
+	var results []Result
+	cfg := srv.Retrieval
+	if mode := Mode(params.Get("mode")); mode != "" {
+		if err := mode.Valid(); err != nil {
+			srv.fail(w, http.StatusBadRequest, err)
+			return
+		}
+		cfg.Mode = mode
+	}
+	if params.Get("approx") == "1" {
+		cfg.Approx = true
+	}
+	cfg.K = k
+	for name, p := range map[string]*int{"rerank": &cfg.Rerank, "around": &cfg.Around} {
+		if s := params.Get(name); s != "" {
+			if *p, err = strconv.Atoi(s); err != nil || *p < 0 {
+				srv.fail(w, http.StatusBadRequest, fmt.Errorf("bad %s: %q", name, s))
+				return
+			}
+		}
+	}
+	results = srv.Find(cfg, q, filters...)
+	if cfg.Rerank > 0 && strings.TrimSpace(q.Text) != "" {
+		rsp := searchResponse{Query: params.Get("q"), Hits: []Hit{}}
+		for _, m := range srv.Pinpoint(cfg, q.Text, results) {
+			rsp.Hits = append(rsp.Hits, hitOfMatch(m))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rsp)
+		return
+	}
+	qv := srv.VectorizeQuery(q.Text)
+	rsp := searchResponse{Query: params.Get("q"), Hits: make([]Hit, 0, k)}
+	for _, r := range results {
+		if len(rsp.Hits) == k {
+			break
+		}
+		if math.IsNaN(float64(r.Distance)) {
+			continue
+		}
+		rsp.Hits = append(rsp.Hits, hitOf(r, srv.Highlights(r.Lens, q.Text, 3), srv.Excerpts(r.Lens, qv, 3)))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rsp)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// testServer serves an index of three channels holding one lens each, an
+// hour apart: two in the guild "home" and a direct message with bob.
+func testServer(t *testing.T, cfg Retrieval) *Server {
+	index := &Index{Vocab: testVocab(), Retrieval: cfg}
+	for i, content := range []string{"cat dog", "pet cat", "rain sunny"} {
+		chID := string('1' + rune(i))
+		origin := Origin{ChID: chID, GuildID: "9", Guild: "home", Name: "ch" + chID}
+		if chID == "3" {
+			origin = Origin{ChID: chID, Recipients: []string{"bob#0002"}}
+		}
+		feed := Feed{origin, &Replay{Messages: testMessages(chID, 60*i, content)}}
+		if _, err := index.Hydrate(feed, 512); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &Server{Index: index, MaxK: 100}
+}
+
+// search requests target from srv, returning the status and the response.
+func search(srv *Server, target string) (code int, rsp searchResponse) {
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	json.NewDecoder(rec.Body).Decode(&rsp)
+	return rec.Code, rsp
+}
+
+// TestServeK checks that k is honoured whatever K the server was started
+// with, approximate or not.
+func TestServeK(t *testing.T) {
+	for _, cfg := range []Retrieval{{K: 1}, {K: 1, Approx: true}} {
+		srv := testServer(t, cfg)
+		for _, target := range []string{"/search?q=cat&k=3", "/search?q=cat&k=3&approx=1"} {
+			if code, rsp := search(srv, target); code != http.StatusOK || len(rsp.Hits) != 3 {
+				t.Errorf("%s with -approx=%v: status %d, %d hits", target, cfg.Approx, code, len(rsp.Hits))
+			}
+		}
+	}
+}
+
+func TestServe(t *testing.T) {
+	srv := testServer(t, Retrieval{K: 8})
+	// the second channel's message was sent an hour after the first's
+	hour := url.QueryEscape(idTime(testMessages("", 30, "")[0].ID).Format(time.RFC3339))
+	for _, tc := range []struct {
+		target string
+		code   int
+		want   []string
+	}{
+		{"/search?q=cat", http.StatusOK, []string{"1", "2", "3"}},
+		{"/search?q=cat&k=2", http.StatusOK, []string{"1", "2"}},
+		{"/search?q=cat&ch=CH2", http.StatusOK, []string{"2"}},
+		{"/search?q=cat&ch=%23ch1&ch=3", http.StatusOK, []string{"1", "3"}},
+		{"/search?q=cat&ch=bob", http.StatusOK, []string{"3"}},
+		{"/search?q=cat&ch=HOME", http.StatusOK, []string{"1", "2"}},
+		{"/search?q=cat+in:bob%230002", http.StatusOK, []string{"3"}},
+		{"/search?q=cat&after=" + hour, http.StatusOK, []string{"2", "3"}},
+		{"/search?q=cat&before=" + hour, http.StatusOK, []string{"1"}},
+		{"/search?q=cat&after=2000-01-01&before=2000-01-02", http.StatusOK, []string{}},
+		{"/search", http.StatusBadRequest, nil},
+		{"/search?q=cat&k=0", http.StatusBadRequest, nil},
+		{"/search?q=cat&k=many", http.StatusBadRequest, nil},
+		{"/search?q=cat&after=yesterday", http.StatusBadRequest, nil},
+		{"/search?q=cat&before=2020-13-01", http.StatusBadRequest, nil},
+		{"/search?q=cat&mode=fuzzy", http.StatusBadRequest, nil},
+		{"/search?q=cat&rerank=-1", http.StatusBadRequest, nil},
+		{"/search?q=%22cat", http.StatusBadRequest, nil},
+	} {
+		code, rsp := search(srv, tc.target)
+		if code != tc.code {
+			t.Errorf("%s: status %d, want %d", tc.target, code, tc.code)
+			continue
+		}
+		if tc.want == nil {
+			continue
+		}
+		got := make([]string, 0, len(rsp.Hits))
+		for _, hit := range rsp.Hits {
+			got = append(got, hit.ChID)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: channels %v, want %v", tc.target, got, tc.want)
+		}
+	}
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/search?q=cat", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: status %d", rec.Code)
+	}
+}
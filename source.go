@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+
+	dgo "github.com/bwmarrin/discordgo"
+)
+
+// MessageSource yields the messages of a single channel in order. Unroll
+// passes them to fn until fn returns false or the source runs out, in which
+// case it returns io.EOF; the next call picks up where the last one stopped.
+// Cursor is the ID of the last message yielded, from which a new source over
+// the same channel can resume.
+type MessageSource interface {
+	Unroll(fn func(*dgo.Message) bool) error
+	Cursor() string
+}
+
+// Unreader is a MessageSource that can take back messages it has yielded, to
+// yield them again, in the same order, before any others.
+type Unreader interface {
+	MessageSource
+	Unread(msgs ...*dgo.Message)
+}
+
+// Feed pairs a MessageSource with the channel it reads from.
+type Feed struct {
+	Origin
+	MessageSource
+}
+
+// JSONL reads messages encoded one JSON object per line, as discordgo
+// marshals them, in the order they appear in the file.
+type JSONL struct {
+	io.Closer
+	sc     *bufio.Scanner
+	held   []*dgo.Message
+	cursor string
+}
+
+// OpenJSONL opens a JSONL message log, skipping everything up to and
+// including the message with ID after, if given.
+func OpenJSONL(path, after string) (src *JSONL, err error) {
+	istrm, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	sc := bufio.NewScanner(istrm)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	src = &JSONL{Closer: istrm, sc: sc}
+	if after != "" {
+		err = src.Unroll(func(msg *dgo.Message) bool {
+			return msg.ID != after
+		})
+		if err == io.EOF {
+			err = nil
+		}
+	}
+	if err != nil {
+		istrm.Close()
+		src = nil
+	}
+	return
+}
+
+func (src *JSONL) next() (msg *dgo.Message, err error) {
+	if len(src.held) > 0 {
+		msg, src.held = src.held[0], src.held[1:]
+		return
+	}
+	for src.sc.Scan() {
+		if len(src.sc.Bytes()) == 0 {
+			continue
+		}
+		msg = &dgo.Message{}
+		err = json.Unmarshal(src.sc.Bytes(), msg)
+		return
+	}
+	if err = src.sc.Err(); err == nil {
+		err = io.EOF
+	}
+	return
+}
+
+// Peek returns the next message without consuming it.
+func (src *JSONL) Peek() (msg *dgo.Message, err error) {
+	if msg, err = src.next(); err == nil {
+		src.Unread(msg)
+	}
+	return
+}
+
+func (src *JSONL) Unread(msgs ...*dgo.Message) {
+	src.held = append(msgs[:len(msgs):len(msgs)], src.held...)
+}
+
+func (src *JSONL) Unroll(fn func(*dgo.Message) bool) error {
+	for {
+		msg, err := src.next()
+		if err != nil {
+			return err
+		}
+		src.cursor = msg.ID
+		if !fn(msg) {
+			return nil
+		}
+	}
+}
+
+func (src *JSONL) Cursor() string {
+	return src.cursor
+}
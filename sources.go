@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	dgo "github.com/bwmarrin/discordgo"
+)
+
+// Thread channel types, which the pinned discordgo predates.
+const (
+	channelTypeGuildNewsThread    dgo.ChannelType = 10
+	channelTypeGuildPublicThread  dgo.ChannelType = 11
+	channelTypeGuildPrivateThread dgo.ChannelType = 12
+)
+
+func isThread(ch *dgo.Channel) bool {
+	switch ch.Type {
+	case channelTypeGuildNewsThread, channelTypeGuildPublicThread, channelTypeGuildPrivateThread:
+		return true
+	}
+	return false
+}
+
+func isText(ch *dgo.Channel) bool {
+	switch ch.Type {
+	case dgo.ChannelTypeGuildText, dgo.ChannelTypeGuildNews:
+		return true
+	}
+	return isThread(ch)
+}
+
+// listFlag is a flag.Value collecting comma-separated values across repeated
+// uses of the same flag.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(s string) error {
+	for _, x := range strings.Split(s, ",") {
+		if x = strings.TrimSpace(x); x != "" {
+			*l = append(*l, x)
+		}
+	}
+	return nil
+}
+
+// Selector decides which channels are indexed. Include and Exclude hold
+// channel IDs or globs over channel names; a thread also matches through its
+// parent channel's ID.
+type Selector struct {
+	DMs     bool
+	Guilds  []string
+	Include []string
+	Exclude []string
+}
+
+func matchAny(patterns []string, ch *dgo.Channel) bool {
+	for _, p := range patterns {
+		if p == ch.ID || p == ch.ParentID {
+			return true
+		}
+		if ok, _ := path.Match(p, ch.Name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Admits reports whether ch should be indexed.
+func (sel *Selector) Admits(ch *dgo.Channel) bool {
+	if ch.GuildID == "" {
+		if !sel.DMs {
+			return false
+		}
+	} else {
+		found := false
+		for _, gid := range sel.Guilds {
+			found = found || gid == ch.GuildID
+		}
+		if !found || !isText(ch) {
+			return false
+		}
+	}
+	if matchAny(sel.Exclude, ch) {
+		return false
+	}
+	return len(sel.Include) == 0 || matchAny(sel.Include, ch)
+}
+
+type threadPage struct {
+	Threads []*dgo.Channel `json:"threads"`
+	HasMore bool           `json:"has_more"`
+}
+
+// archived thread pages are keyed by archive time, which the pinned discordgo
+// does not decode into Channel
+type threadPageMeta struct {
+	Threads []struct {
+		Meta struct {
+			ArchiveTimestamp string `json:"archive_timestamp"`
+		} `json:"thread_metadata"`
+	} `json:"threads"`
+}
+
+// forbidden reports whether err is the API refusing access, which merely
+// means a channel is not readable with this token.
+func forbidden(err error) bool {
+	rerr, ok := err.(*dgo.RESTError)
+	return ok && rerr.Response != nil && rerr.Response.StatusCode == http.StatusForbidden
+}
+
+func threads(s *dgo.Session, endpoint string) (chs []*dgo.Channel, err error) {
+	before := ""
+	for {
+		uri := endpoint
+		if before != "" {
+			uri = fmt.Sprintf("%s?before=%s", endpoint, url.QueryEscape(before))
+		}
+		var body []byte
+		if body, err = s.RequestWithBucketID("GET", uri, nil, endpoint); err != nil {
+			return
+		}
+		var (
+			page threadPage
+			meta threadPageMeta
+		)
+		if err = json.Unmarshal(body, &page); err != nil {
+			return
+		}
+		if err = json.Unmarshal(body, &meta); err != nil {
+			return
+		}
+		chs = append(chs, page.Threads...)
+		if !page.HasMore || len(meta.Threads) == 0 {
+			return
+		}
+		before = meta.Threads[len(meta.Threads)-1].Meta.ArchiveTimestamp
+	}
+}
+
+// Channels enumerates the DMs, guild text channels and threads that sel
+// admits.
+func (sel *Selector) Channels(s *dgo.Session) (chs []*dgo.Channel, err error) {
+	var candidates []*dgo.Channel
+	if sel.DMs {
+		if candidates, err = s.UserChannels(); err != nil {
+			return
+		}
+	}
+	for _, gid := range sel.Guilds {
+		var guildChs, active []*dgo.Channel
+		if guildChs, err = s.GuildChannels(gid); err != nil {
+			return
+		}
+		if active, err = threads(s, dgo.EndpointGuild(gid)+"/threads/active"); err != nil {
+			return
+		}
+		candidates = append(candidates, guildChs...)
+		candidates = append(candidates, active...)
+		for _, ch := range guildChs {
+			if !isText(ch) {
+				continue
+			}
+			var archived []*dgo.Channel
+			endpoint := dgo.EndpointChannel(ch.ID) + "/threads/archived/public"
+			if archived, err = threads(s, endpoint); forbidden(err) {
+				err = nil
+				continue
+			} else if err != nil {
+				return
+			}
+			candidates = append(candidates, archived...)
+		}
+	}
+	for _, ch := range candidates {
+		if sel.Admits(ch) {
+			chs = append(chs, ch)
+		}
+	}
+	return
+}
+
+// resolve looks a channel up in the gateway state before asking the API.
+func resolve(s *dgo.Session, chID string) (ch *dgo.Channel, err error) {
+	if s.State != nil {
+		if ch, err = s.State.Channel(chID); err == nil {
+			return
+		}
+	}
+	return s.Channel(chID)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/sajari/fuzzy"
+)
+
+// spellMinCount is how often a word the vocabulary lacks must occur in the
+// index before it is offered as a correction; rarer ones are likely typos
+// themselves.
+const spellMinCount = 3
+
+func spellPath(path string) string {
+	return path + ".spell"
+}
+
+// spellSeedMax is the most words of the embedding vocabulary a model is
+// seeded with, since the largest ones would not fit in memory.
+const spellSeedMax = 1 << 18
+
+// Train fits a fresh model to the words of the indexed messages, seeded with
+// the first spellSeedMax plain lowercase words of seed at a count of one, so
+// that words the index never saw can be suggested but those it did take
+// precedence. Every word is counted, but only those the vocabulary knows, or
+// that are common enough, may be suggested.
+func (cker *SpellChker) Train(index *Index, seed Enumerable) {
+	counts := make(map[string]int)
+	if seed != nil {
+		seed.Words(func(t string) bool {
+			if plain(t) {
+				counts[t] = 1
+			}
+			return len(counts) < spellSeedMax
+		})
+	}
+	index.RLock()
+	for _, lens := range index.qledger {
+		for _, msg := range lens.Messages {
+			for _, t := range tokens(msg.Content) {
+				counts[t]++
+			}
+		}
+	}
+	index.RUnlock()
+	model := fuzzy.NewModel()
+	model.SetDepth(2)
+	for t, n := range counts {
+		model.SetCount(t, n, n >= spellMinCount || cker.known(t))
+	}
+	cker.Model = model
+}
+
+// plain reports whether t is a lowercase word, unlike the phrases, names and
+// numbers some vocabularies also embed.
+func plain(t string) bool {
+	for _, r := range t {
+		if !unicode.IsLower(r) {
+			return false
+		}
+	}
+	return t != ""
+}
+
+func (cker SpellChker) known(t string) bool {
+	return cker.Vocab != nil && cker.Embed(t) != nil
+}
+
+// Suggest returns the correction for an unknown word t, or "" if t is known
+// or the model has nothing better.
+func (cker SpellChker) Suggest(t string) string {
+	if cker.Model == nil || t == "" || cker.known(t) {
+		return ""
+	}
+	if s := cker.SpellCheck(t); s != t {
+		return s
+	}
+	return ""
+}
+
+// Correct rewrites the unknown words of a query, returning "" if none of
+// them has a correction.
+func (cker SpellChker) Correct(q string) string {
+	lexer := Collector{Sanitizer: SanitizerChain{StripPunct, ToLower}}
+	EmbedPolicy.Lex(&lexer, q)
+	changed := false
+	for i, t := range lexer.Tokens {
+		if s := cker.Suggest(t); s != "" {
+			lexer.Tokens[i], changed = s, true
+		}
+	}
+	if !changed {
+		return ""
+	}
+	return strings.Join(lexer.Tokens, " ")
+}
+
+// Save writes the model next to the index at path.
+func (cker SpellChker) Save(path string) error {
+	return cker.Model.Save(spellPath(path))
+}
+
+// Load reads the model saved next to the index at path.
+func (cker *SpellChker) Load(path string) (err error) {
+	cker.Model, err = fuzzy.Load(spellPath(path))
+	return
+}
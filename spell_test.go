@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+// TestSpell checks that the speller suggests vocabulary words the index never
+// saw, and that lexical search still matches unknown words indexed since it
+// was trained, as live ones are.
+func TestSpell(t *testing.T) {
+	vocab := testVocab()
+	index := &Index{Vocab: vocab}
+	hydrate := func(chID string, contents ...string) {
+		feed := Feed{Origin{ChID: chID}, &Replay{Messages: testMessages(chID, 1, contents...)}}
+		if _, err := index.Hydrate(feed, 512); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hydrate("1", "cat dog pet", "cat cat")
+	cker := &SpellChker{Vocab: vocab}
+	cker.Train(index, vocab)
+	for typo, want := range map[string]string{"dgo": "dog", "clouyd": "cloudy", "cloudy": ""} {
+		if got := cker.Suggest(typo); got != want {
+			t.Errorf("Suggest(%q) = %q, want %q", typo, got, want)
+		}
+	}
+	index.Spell = cker
+	hydrate("2", "cst crashed again")
+	results := index.SearchWith(Retrieval{Mode: Lexical}, "cst")
+	if len(results) != 1 || results[0].ChID != "2" {
+		t.Errorf("lexical search for an unknown word: %v", results)
+	}
+}
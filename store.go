@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// storeMagic opens every Store file. Its last byte is the version of the
+// layout.
+const storeMagic = "DMVEC\x00\x00\x02"
+
+// FormatStore is the memory-mapped layout written by WriteStore.
+const FormatStore = "store"
+
+// Store is a read-only embedding table laid out to be memory-mapped, so that
+// only the pages holding words that are actually looked up get loaded:
+//
+//	magic [8]byte | wordc, dim uint64 | offsets [wordc+1]uint64 |
+//	ranks [wordc]uint64 | words | matrix
+//
+// The words are sorted bytewise and concatenated; offsets index into them.
+// Ranks lists their sorted indices in the order the source vocabulary gave
+// them, which is usually most frequent first. The matrix holds one
+// little-endian float32 row per word in sorted order.
+type Store struct {
+	data    []byte
+	offsets []byte
+	ranks   []byte
+	words   []byte
+	matrix  []byte
+	wordc   int
+	dim     int
+	unmap   func() error
+}
+
+// WriteStore converts eb to the Store layout.
+func WriteStore(ostrm io.Writer, eb *Embeddings) (err error) {
+	eb.RLock()
+	defer eb.RUnlock()
+	ranked := eb.ranked()
+	words := append([]string(nil), ranked...)
+	sort.Strings(words)
+	index := make(map[string]int, len(words))
+	for i, t := range words {
+		index[t] = i
+	}
+	wr := bufio.NewWriterSize(ostrm, 1<<20)
+	var u64 [8]byte
+	put := func(x uint64) {
+		binary.LittleEndian.PutUint64(u64[:], x)
+		wr.Write(u64[:])
+	}
+	wr.WriteString(storeMagic)
+	put(uint64(len(words)))
+	put(uint64(eb.dim))
+	var off uint64
+	put(off)
+	for _, t := range words {
+		off += uint64(len(t))
+		put(off)
+	}
+	for _, t := range ranked {
+		put(uint64(index[t]))
+	}
+	for _, t := range words {
+		wr.WriteString(t)
+	}
+	var f32 [4]byte
+	for _, t := range words {
+		v := eb.Dict[t]
+		if len(v) != eb.dim {
+			return fmt.Errorf("%q has %d dimensions, want %d", t, len(v), eb.dim)
+		}
+		for _, x := range v {
+			binary.LittleEndian.PutUint32(f32[:], math.Float32bits(x))
+			wr.Write(f32[:])
+		}
+	}
+	return wr.Flush()
+}
+
+// OpenStore maps the Store at path into memory.
+func OpenStore(path string) (st *Store, err error) {
+	data, unmap, err := mmapFile(path)
+	if err != nil {
+		return
+	}
+	st = &Store{data: data, unmap: unmap}
+	if err = st.parse(); err != nil {
+		unmap()
+		st = nil
+		err = fmt.Errorf("%s: %s", path, err)
+	}
+	return
+}
+
+func (st *Store) parse() (err error) {
+	const header = len(storeMagic) + 16
+	data := st.data
+	magic := len(storeMagic) - 1
+	if len(data) < header || string(data[:magic]) != storeMagic[:magic] {
+		return fmt.Errorf("not an embedding store")
+	}
+	if data[magic] != storeMagic[magic] {
+		return fmt.Errorf("store version %d, want %d; convert the vocabulary again",
+			data[magic], storeMagic[magic])
+	}
+	wordc := binary.LittleEndian.Uint64(data[len(storeMagic):])
+	dim := binary.LittleEndian.Uint64(data[len(storeMagic)+8:])
+	data = data[header:]
+	if uint64(len(data))/8 <= 2*wordc {
+		return fmt.Errorf("truncated offset table")
+	}
+	st.wordc, st.dim = int(wordc), int(dim)
+	st.offsets, data = data[:8*(st.wordc+1)], data[8*(st.wordc+1):]
+	st.ranks, data = data[:8*st.wordc], data[8*st.wordc:]
+	wordsz := binary.LittleEndian.Uint64(st.offsets[8*st.wordc:])
+	if uint64(len(data)) < wordsz {
+		return fmt.Errorf("truncated vocabulary")
+	}
+	st.words, st.matrix = data[:wordsz], data[wordsz:]
+	if uint64(len(st.matrix)) != 4*wordc*dim {
+		return fmt.Errorf("matrix is %d bytes, want %d", len(st.matrix), 4*wordc*dim)
+	}
+	return
+}
+
+func (st *Store) Close() error {
+	return st.unmap()
+}
+
+func (st *Store) Len() int {
+	return st.wordc
+}
+
+func (st *Store) Dim() int {
+	return st.dim
+}
+
+// Word returns the i-th word in sorted order.
+func (st *Store) Word(i int) string {
+	return string(st.word(i))
+}
+
+func (st *Store) word(i int) []byte {
+	lo := binary.LittleEndian.Uint64(st.offsets[8*i:])
+	hi := binary.LittleEndian.Uint64(st.offsets[8*(i+1):])
+	return st.words[lo:hi]
+}
+
+func (st *Store) Each(fn func(t string, v Vec)) {
+	for i := 0; i < st.wordc; i++ {
+		fn(st.Word(i), st.row(i))
+	}
+}
+
+// Words lists the words in the order the source vocabulary gave them until fn
+// returns false, without reading their rows.
+func (st *Store) Words(fn func(t string) bool) {
+	for k := 0; k < st.wordc; k++ {
+		if !fn(st.Word(int(binary.LittleEndian.Uint64(st.ranks[8*k:])))) {
+			return
+		}
+	}
+}
+
+// Embed copies out the row for t, or returns nil if t is not in the store.
+func (st *Store) Embed(t string) Vec {
+	i := sort.Search(st.wordc, func(i int) bool {
+		return string(st.word(i)) >= t
+	})
+	if i == st.wordc || string(st.word(i)) != t {
+		return nil
+	}
+	return st.row(i)
+}
+
+func (st *Store) row(i int) Vec {
+	row := st.matrix[4*i*st.dim : 4*(i+1)*st.dim]
+	v := make(Vec, st.dim)
+	for j := range v {
+		v[j] = math.Float32frombits(binary.LittleEndian.Uint32(row[4*j:]))
+	}
+	return v
+}
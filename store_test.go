@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	eb := testVocab()
+	eb.order = []string{"rain", "cat"}
+	path := filepath.Join(dir, "vocab.store")
+	ostrm, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = WriteStore(ostrm, eb); err != nil {
+		t.Fatal(err)
+	}
+	ostrm.Close()
+	st, err := OpenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	if st.Len() != len(eb.Dict) || st.Dim() != eb.dim {
+		t.Errorf("%d words of %d dimensions", st.Len(), st.Dim())
+	}
+	if first, last := st.Word(0), st.Word(st.Len()-1); first != "cat" || last != "sunny" {
+		t.Errorf("words run from %q to %q", first, last)
+	}
+	for _, w := range []string{"cat", "sunny", "pet"} {
+		if v := st.Embed(w); !reflect.DeepEqual(v, eb.Dict[w]) {
+			t.Errorf("%s: %v, want %v", w, v, eb.Dict[w])
+		}
+	}
+	for _, w := range []string{"aardvark", "zebra", "ca", ""} {
+		if v := st.Embed(w); v != nil {
+			t.Errorf("%q: %v for a missing word", w, v)
+		}
+	}
+	var words []string
+	st.Words(func(t string) bool {
+		words = append(words, t)
+		return true
+	})
+	if want := []string{"rain", "cat", "cloudy", "dog", "pet", "sunny"}; !reflect.DeepEqual(words, want) {
+		t.Errorf("words in order %v, want %v", words, want)
+	}
+
+	eb.Dict["pet"] = Vec{1, 2}
+	if err = WriteStore(ioutil.Discard, eb); err == nil {
+		t.Error("wrote a row of the wrong dimension")
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt := func(name string, data []byte) {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if st, err := OpenStore(path); err == nil {
+			st.Close()
+			t.Errorf("opened a store with %s", name)
+		}
+	}
+	corrupt("a truncated matrix", data[:len(data)-1])
+	corrupt("a truncated vocabulary", data[:len(data)-4*st.Len()*st.Dim()-1])
+	corrupt("a truncated offset table", data[:len(storeMagic)+24])
+	corrupt("a truncated header", data[:len(storeMagic)+4])
+	magic := append([]byte(nil), data...)
+	magic[0] = 'X'
+	corrupt("bad magic", magic)
+	version := append([]byte(nil), data...)
+	version[len(storeMagic)-1]--
+	corrupt("an old version", version)
+}
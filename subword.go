@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+)
+
+// Enumerable vocabularies can list their words and vectors, or their words
+// alone, most frequent first where the source vocabulary says so.
+type Enumerable interface {
+	Vocab
+	Each(fn func(t string, v Vec))
+	Words(fn func(t string) bool)
+}
+
+// Grams is a table of character n-gram vectors addressed by bucket.
+type Grams interface {
+	Buckets() int
+	// Row returns the vector of bucket i, or nil if nothing hashed to it.
+	Row(i int) Vec
+}
+
+// Subword falls back on character n-grams for the words its Vocab lacks, the
+// way fastText does: a word is wrapped in "<" and ">", and its vector is the
+// mean of the vectors of its n-grams between MinN and MaxN runes long.
+// Typos, slang and usernames then still land near the words they resemble.
+type Subword struct {
+	Vocab
+	Grams
+	MinN, MaxN int
+}
+
+// gramHash is fastText's FNV-1a variant, which sign-extends each byte.
+func gramHash(gram string) (h uint32) {
+	h = 2166136261
+	for i := 0; i < len(gram); i++ {
+		h ^= uint32(int8(gram[i]))
+		h *= 16777619
+	}
+	return
+}
+
+// subwords calls fn with the bucket of each n-gram of t, enumerated exactly as
+// fastText's Dictionary::computeSubwords does.
+func subwords(t string, minn, maxn, buckets int, fn func(bucket int)) {
+	if buckets == 0 {
+		return
+	}
+	word := "<" + t + ">"
+	for i := 0; i < len(word); i++ {
+		if word[i]&0xC0 == 0x80 {
+			continue
+		}
+		for j, n := i, 1; j < len(word) && n <= maxn; n++ {
+			j++
+			for j < len(word) && word[j]&0xC0 == 0x80 {
+				j++
+			}
+			if n >= minn && !(n == 1 && (i == 0 || j == len(word))) {
+				fn(int(gramHash(word[i:j]) % uint32(buckets)))
+			}
+		}
+	}
+}
+
+func (sw *Subword) Embed(t string) Vec {
+	if v := sw.Vocab.Embed(t); v != nil {
+		return v
+	}
+	var (
+		mean Vec
+		n    int
+	)
+	subwords(t, sw.MinN, sw.MaxN, sw.Buckets(), func(bucket int) {
+		row := sw.Row(bucket)
+		if row == nil {
+			return
+		}
+		if mean == nil {
+			mean = make(Vec, len(row))
+		}
+		for i, x := range row {
+			mean[i] += x
+		}
+		n++
+	})
+	for i := range mean {
+		mean[i] /= float32(n)
+	}
+	return mean
+}
+
+// GramTable holds n-gram vectors hashed from the words of a vocabulary, for
+// when no trained subword table is at hand. Each bucket is the mean of the
+// words whose n-grams fall into it.
+type GramTable struct {
+	dim    int
+	rows   []float32
+	counts []int
+}
+
+// HashGrams builds a GramTable of the given size over every word in vocab.
+func HashGrams(vocab Enumerable, buckets, minn, maxn int) (table *GramTable) {
+	dim := vocab.Dim()
+	table = &GramTable{
+		dim:    dim,
+		rows:   make([]float32, buckets*dim),
+		counts: make([]int, buckets),
+	}
+	vocab.Each(func(t string, v Vec) {
+		subwords(t, minn, maxn, buckets, func(bucket int) {
+			row := table.rows[bucket*dim : (bucket+1)*dim]
+			for i, x := range v {
+				row[i] += x
+			}
+			table.counts[bucket]++
+		})
+	})
+	for bucket, n := range table.counts {
+		if n == 0 {
+			continue
+		}
+		row := table.rows[bucket*dim : (bucket+1)*dim]
+		for i := range row {
+			row[i] /= float32(n)
+		}
+	}
+	return
+}
+
+func (table *GramTable) Buckets() int {
+	return len(table.counts)
+}
+
+func (table *GramTable) Row(i int) Vec {
+	if table.counts[i] == 0 {
+		return nil
+	}
+	return Vec(table.rows[i*table.dim : (i+1)*table.dim])
+}
+
+// fastTextMagic opens every fastText model file.
+const fastTextMagic = 793712314
+
+// FastText is the subword table of a trained fastText .bin model, mapped into
+// memory. Only the bucket rows of its input matrix are used; the word rows
+// are expected to come from the accompanying .vec through -vocab.
+type FastText struct {
+	matrix     []byte
+	nwords     int
+	buckets    int
+	dim        int
+	MinN, MaxN int
+	unmap      func() error
+}
+
+// countingReader tracks how far into the file the header ends.
+type countingReader struct {
+	*bufio.Reader
+	n int64
+}
+
+func (rd *countingReader) Read(p []byte) (n int, err error) {
+	n, err = rd.Reader.Read(p)
+	rd.n += int64(n)
+	return
+}
+
+func (rd *countingReader) ReadString(delim byte) (s string, err error) {
+	s, err = rd.Reader.ReadString(delim)
+	rd.n += int64(len(s))
+	return
+}
+
+// OpenFastText reads the header of the model at path and maps its input
+// matrix. Quantized (.ftz) models are not supported.
+func OpenFastText(path string) (ft *FastText, err error) {
+	istrm, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	off, ft, err := readFastTextHeader(&countingReader{Reader: bufio.NewReader(istrm)})
+	istrm.Close()
+	if err != nil {
+		err = fmt.Errorf("%s: %s", path, err)
+		return
+	}
+	data, unmap, err := mmapFile(path)
+	if err != nil {
+		return
+	}
+	size := int64(4 * (ft.nwords + ft.buckets) * ft.dim)
+	if int64(len(data)) < off+size {
+		unmap()
+		return nil, fmt.Errorf("%s: truncated input matrix", path)
+	}
+	ft.matrix, ft.unmap = data[off:off+size], unmap
+	return
+}
+
+func readFastTextHeader(rd *countingReader) (off int64, ft *FastText, err error) {
+	var head struct {
+		Magic, Version                                int32
+		Dim, WS, Epoch, MinCount, Neg, WordNgrams     int32
+		Loss, Model, Bucket, MinN, MaxN, LRUpdateRate int32
+		T                                             float64
+		Size, NWords, NLabels                         int32
+		NTokens, PruneIdxSize                         int64
+	}
+	if err = binary.Read(rd, binary.LittleEndian, &head); err != nil {
+		return
+	}
+	if head.Magic != fastTextMagic {
+		err = fmt.Errorf("not a fastText model")
+		return
+	}
+	if head.Version > 12 {
+		err = fmt.Errorf("fastText model version %d is not supported", head.Version)
+		return
+	}
+	for i := int32(0); i < head.Size; i++ {
+		if _, err = rd.ReadString(0); err != nil {
+			return
+		}
+		// count int64, entry type int8
+		if _, err = io.CopyN(ioutil.Discard, rd, 9); err != nil {
+			return
+		}
+	}
+	if head.PruneIdxSize > 0 {
+		if _, err = io.CopyN(ioutil.Discard, rd, 8*head.PruneIdxSize); err != nil {
+			return
+		}
+	}
+	var matrix struct {
+		Quant uint8
+		M, N  int64
+	}
+	if err = binary.Read(rd, binary.LittleEndian, &matrix); err != nil {
+		return
+	}
+	if matrix.Quant != 0 {
+		err = fmt.Errorf("quantized models are not supported")
+		return
+	}
+	if matrix.N != int64(head.Dim) || matrix.M != int64(head.NWords)+int64(head.Bucket) {
+		err = fmt.Errorf("input matrix is %dx%d, want %dx%d",
+			matrix.M, matrix.N, int64(head.NWords)+int64(head.Bucket), head.Dim)
+		return
+	}
+	off = rd.n
+	ft = &FastText{
+		nwords:  int(head.NWords),
+		buckets: int(head.Bucket),
+		dim:     int(head.Dim),
+		MinN:    int(head.MinN),
+		MaxN:    int(head.MaxN),
+	}
+	return
+}
+
+func (ft *FastText) Close() error {
+	return ft.unmap()
+}
+
+func (ft *FastText) Dim() int {
+	return ft.dim
+}
+
+func (ft *FastText) Buckets() int {
+	return ft.buckets
+}
+
+func (ft *FastText) Row(i int) Vec {
+	i += ft.nwords
+	row := ft.matrix[4*i*ft.dim : 4*(i+1)*ft.dim]
+	v := make(Vec, ft.dim)
+	for j := range v {
+		v[j] = math.Float32frombits(binary.LittleEndian.Uint32(row[4*j:]))
+	}
+	return v
+}
@@ -0,0 +1,52 @@
+package main
+
+import "strings"
+
+// TextRank scores the words of candidate phrases by their PageRank over the
+// graph of those co-occurring within Span of one another, and phrases by the
+// sum of their words' ranks. Zero values take the defaults; Convergence
+// reports how the last Finalize ended.
+type TextRank struct {
+	passage
+	Span        int
+	Damping     float64
+	Tolerance   float64
+	MaxIter     int
+	Convergence Convergence
+}
+
+func (tr *TextRank) Finalize() (tokens, phrases []ScoredPhrase) {
+	span := tr.Span
+	if span < 2 {
+		span = 3
+	}
+	spanner := NewCoocSpanner(span, 1024, &PassLex{SanitizerChain{}})
+	for _, sent := range tr.Sentences {
+		// stop words are left out of the graph, and sentences do not
+		// co-occur
+		spanner.Context = spanner.Context[:0]
+		for _, w := range sent {
+			if !w.stop() {
+				spanner.Advance(w.Text)
+			}
+		}
+	}
+	var ranks []float64
+	ranks, tr.Convergence = spanner.TextRank(tr.Tolerance, tr.Damping, tr.MaxIter)
+	scores, words := make(map[string]float64, len(ranks)), make(map[string][]string, len(ranks))
+	for t, i := range spanner.Dict {
+		scores[t], words[t] = ranks[i], []string{t}
+	}
+	pscores, seen := make(map[string]float64), make(map[string][]string)
+	tr.candidates(func(_ int, phrase []string) {
+		k := strings.Join(phrase, " ")
+		if _, ok := seen[k]; ok {
+			return
+		}
+		seen[k] = phrase
+		for _, t := range phrase {
+			pscores[k] += scores[t]
+		}
+	})
+	return ranked(scores, words), ranked(pscores, seen)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// TokenKind classifies the pieces of a Discord message.
+type TokenKind int
+
+const (
+	TokWord TokenKind = iota
+	// TokMention is a user, role or channel mention, as <@id>, <@&id> or <#id>.
+	TokMention
+	// TokEmoji is a custom emoji, as :name:.
+	TokEmoji
+	TokURL
+	// TokCode is a whitespace-separated piece of inline or fenced code.
+	TokCode
+	tokKinds
+)
+
+type Token struct {
+	Kind TokenKind
+	Text string
+}
+
+// markup matches, in order of precedence: fenced code (dropping the language
+// tag), inline code, custom emoji, mentions and URLs, which Discord lets be
+// wrapped in angle brackets to suppress their embeds.
+var markup = regexp.MustCompile("(?s)```(?:[a-zA-Z0-9_+-]*\n)?(.*?)```" +
+	"|`([^`]+)`" +
+	`|<a?:(\w+):\d+>` +
+	`|<(@[!&]?|#)(\d+)>` +
+	`|<?(https?://[^\s<>]+)>?`)
+
+// trimURL drops trailing punctuation that is more likely to close the
+// sentence than to belong to the URL.
+func trimURL(url string) string {
+	url = strings.TrimRight(url, `.,;:!?'"`)
+	if strings.HasSuffix(url, ")") && !strings.Contains(url, "(") {
+		url = strings.TrimRight(url, ")")
+	}
+	return url
+}
+
+// Tokenize splits a message into typed tokens. Everything outside of markup
+// is split on whitespace into words, which are left for a Sanitizer to clean.
+func Tokenize(src string) (toks []Token) {
+	words := func(s string, kind TokenKind) {
+		for _, t := range strings.Fields(s) {
+			toks = append(toks, Token{kind, t})
+		}
+	}
+	end := 0
+	for _, m := range markup.FindAllStringSubmatchIndex(src, -1) {
+		words(src[end:m[0]], TokWord)
+		end = m[1]
+		switch {
+		case m[2] >= 0:
+			words(src[m[2]:m[3]], TokCode)
+		case m[4] >= 0:
+			words(src[m[4]:m[5]], TokCode)
+		case m[6] >= 0:
+			toks = append(toks, Token{TokEmoji, ":" + src[m[6]:m[7]] + ":"})
+		case m[8] >= 0:
+			// <@!id> is the legacy form of <@id>
+			sigil := strings.TrimSuffix(src[m[8]:m[9]], "!")
+			toks = append(toks, Token{TokMention, "<" + sigil + src[m[10]:m[11]] + ">"})
+		default:
+			url := src[m[12]:m[13]]
+			if src[m[0]] != '<' {
+				// return what trimURL cuts off to the text that follows
+				url = trimURL(url)
+				end = m[12] + len(url)
+			}
+			toks = append(toks, Token{TokURL, url})
+		}
+	}
+	words(src[end:], TokWord)
+	return
+}
+
+// Treatment is what a Policy does with a kind of token.
+type Treatment int
+
+const (
+	// Drop skips the token.
+	Drop Treatment = iota
+	// Embed passes the token through the lexer's Sanitizer like any word.
+	Embed
+	// Literal passes the token verbatim, so it can only match itself.
+	Literal
+)
+
+// Policy assigns a Treatment to each kind of token; kinds it leaves out are
+// dropped.
+type Policy [tokKinds]Treatment
+
+var (
+	// EmbedPolicy keeps what word vectors can represent: words, and the
+	// names of custom emoji.
+	EmbedPolicy = Policy{TokWord: Embed, TokEmoji: Embed}
+	// IndexPolicy keeps everything for the lexical index, with markup as
+	// literal terms so that URLs, code and mentions can be searched for.
+	IndexPolicy = Policy{
+		TokWord:    Embed,
+		TokMention: Literal,
+		TokEmoji:   Literal,
+		TokURL:     Literal,
+		TokCode:    Literal,
+	}
+)
+
+// Lex tokenizes src and feeds lexer the tokens the policy keeps, as the
+// package-level Lex does with whitespace-separated ones.
+func (policy Policy) Lex(lexer Lexer, src string) {
+	for _, tok := range Tokenize(src) {
+		t := tok.Text
+		switch policy[tok.Kind] {
+		case Drop:
+			continue
+		case Embed:
+			t = lexer.Sanitize(t)
+		}
+		if !lexer.Advance(t) {
+			return
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	dgo "github.com/bwmarrin/discordgo"
+)
+
+func TestTokenize(t *testing.T) {
+	for _, tc := range []struct {
+		src  string
+		want []Token
+	}{
+		{"nice <:pog:123456> <a:spin:42>", []Token{{TokWord, "nice"}, {TokEmoji, ":pog:"}, {TokEmoji, ":spin:"}}},
+		{"hi <@!80351110224678912> and <@80351110224678913>, <@&5> <#6>", []Token{
+			{TokWord, "hi"}, {TokMention, "<@80351110224678912>"}, {TokWord, "and"},
+			{TokMention, "<@80351110224678913>"}, {TokWord, ","}, {TokMention, "<@&5>"}, {TokMention, "<#6>"}}},
+		{"see <https://example.com/a?b=c.>.", []Token{
+			{TokWord, "see"}, {TokURL, "https://example.com/a?b=c."}, {TokWord, "."}}},
+		{"see https://example.com/a, or (https://example.com/b).", []Token{
+			{TokWord, "see"}, {TokURL, "https://example.com/a"}, {TokWord, ","}, {TokWord, "or"},
+			{TokWord, "("}, {TokURL, "https://example.com/b"}, {TokWord, ")."}}},
+		{"https://en.wikipedia.org/wiki/Go_(game)!", []Token{
+			{TokURL, "https://en.wikipedia.org/wiki/Go_(game)"}, {TokWord, "!"}}},
+		{"run ```go\nfmt.Println(x)\n``` now", []Token{
+			{TokWord, "run"}, {TokCode, "fmt.Println(x)"}, {TokWord, "now"}}},
+		{"```\nplain code```", []Token{{TokCode, "plain"}, {TokCode, "code"}}},
+		{"use `go vet` first", []Token{{TokWord, "use"}, {TokCode, "go"}, {TokCode, "vet"}, {TokWord, "first"}}},
+	} {
+		if got := Tokenize(tc.src); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: %v, want %v", tc.src, got, tc.want)
+		}
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	src := "Cats! <:pog:1> <@!2> https://example.com `x`"
+	for _, tc := range []struct {
+		policy Policy
+		want   string
+	}{
+		{EmbedPolicy, "cats pog"},
+		{IndexPolicy, "cats :pog: <@2> https://example.com x"},
+	} {
+		lexer := Collector{Sanitizer: SanitizerChain{StripPunct, ToLower}}
+		tc.policy.Lex(&lexer, src)
+		if got := strings.Join(lexer.Tokens, " "); got != tc.want {
+			t.Errorf("%v: %q, want %q", tc.policy, got, tc.want)
+		}
+	}
+}
+
+// TestMentionSearch checks that a user mention is indexed by ID, whatever
+// form it was sent in, while it is shown by name.
+func TestMentionSearch(t *testing.T) {
+	index := &Index{Vocab: testVocab()}
+	msgs := testMessages("1", 1, "<@!80351110224678913> cat")
+	msgs[0].Mentions = []*dgo.User{{ID: "80351110224678913", Username: "bob"}}
+	lens, err := index.Hydrate(Feed{Origin{ChID: "1"}, &Replay{Messages: msgs}}, 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := lens.Messages[0].Text(); got != "@bob cat" {
+		t.Errorf("shown as %q", got)
+	}
+	for _, q := range []string{"<@80351110224678913>", "<@!80351110224678913>"} {
+		if results := index.SearchWith(Retrieval{Mode: Lexical}, q); len(results) != 1 {
+			t.Errorf("%s: %d results", q, len(results))
+		}
+	}
+}
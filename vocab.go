@@ -1,11 +1,15 @@
 package main
 
 import (
+	"bufio"
 	"encoding/binary"
 	"fmt"
 	"gonum.org/v1/gonum/blas/blas32"
 	"gonum.org/v1/gonum/mat"
 	"io"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 )
 
@@ -58,6 +62,9 @@ type Embeddings struct {
 	Dict map[string]Vec
 	sync.RWMutex
 	dim int
+	// order lists the words as they were read, which word2vec and fastText
+	// files give most frequent first.
+	order []string
 }
 
 func (eb *Embeddings) Len() int {
@@ -86,77 +93,258 @@ func (eb *Embeddings) Embed(t string) Vec {
 	return nil
 }
 
+func (eb *Embeddings) Each(fn func(t string, v Vec)) {
+	eb.RLock()
+	defer eb.RUnlock()
+	for t, v := range eb.Dict {
+		fn(t, v)
+	}
+}
+
+// Words lists the words in the order they were read until fn returns false.
+func (eb *Embeddings) Words(fn func(t string) bool) {
+	eb.RLock()
+	defer eb.RUnlock()
+	for _, t := range eb.ranked() {
+		if !fn(t) {
+			return
+		}
+	}
+}
+
+// ranked lists every word once, in the order they were read, followed by any
+// that were not read in sorted order.
+func (eb *Embeddings) ranked() (words []string) {
+	if len(eb.order) == len(eb.Dict) {
+		return eb.order
+	}
+	seen := make(map[string]struct{}, len(eb.Dict))
+	words = make([]string, 0, len(eb.Dict))
+	for _, t := range eb.order {
+		if _, ok := seen[t]; !ok && eb.Dict[t] != nil {
+			seen[t] = struct{}{}
+			words = append(words, t)
+		}
+	}
+	rest := make([]string, 0, len(eb.Dict)-len(words))
+	for t := range eb.Dict {
+		if _, ok := seen[t]; !ok {
+			rest = append(rest, t)
+		}
+	}
+	sort.Strings(rest)
+	return append(words, rest...)
+}
+
+// ReadBin reads the binary word2vec format: a "count dimensions" header,
+// then each word followed by a space and its little-endian components, and
+// optionally by a newline.
 func (eb *Embeddings) ReadBin(istrm io.Reader) (err error) {
-	var (
-		wordc, dimen int
-		t            string
-	)
-	_, err = fmt.Fscanf(istrm, "%d %d\n", &wordc, &dimen)
+	rd, ok := istrm.(*bufio.Reader)
+	if !ok {
+		rd = bufio.NewReader(istrm)
+	}
+	var wordc, dimen int
+	_, err = fmt.Fscanf(rd, "%d %d\n", &wordc, &dimen)
 	if err != nil {
 		return
 	}
 	eb.Dict = make(map[string]Vec, wordc)
+	eb.order = make([]string, 0, wordc)
 	eb.dim = dimen
 	for i := 0; i < wordc; i++ {
-		_, err = fmt.Fscanf(istrm, "%s", &t)
+		// Fscanf would unread the space after the word into rd, leaving the
+		// components one byte off
+		var t string
+		t, err = rd.ReadString(' ')
 		if err != nil {
-			if err == io.EOF {
+			if err == io.EOF && strings.TrimSpace(t) == "" {
 				err = nil
 			}
 			return
 		}
+		t = strings.TrimLeft(strings.TrimSuffix(t, " "), "\n")
 		embedding := make(Vec, dimen)
-		if err = binary.Read(istrm, binary.LittleEndian, embedding); err != nil {
+		if err = binary.Read(rd, binary.LittleEndian, embedding); err != nil {
 			return
 		}
 		eb.Dict[t] = embedding
+		eb.order = append(eb.order, t)
 	}
 	return
 }
 
+// EmbedTxt reads the text word2vec format, which fastText also uses for its
+// .vec files: a "count dimensions" header, then one word per line followed by
+// its components.
 func (eb *Embeddings) EmbedTxt(istrm io.Reader) (err error) {
-	var (
-		wordc, dimen int
-		t            string
-	)
-	_, err = fmt.Fscanf(istrm, "%d %d", &wordc, &dimen)
-	if err != nil {
+	rd := bufio.NewReader(istrm)
+	var wordc, dimen int
+	if _, err = fmt.Fscanf(rd, "%d %d\n", &wordc, &dimen); err != nil {
+		return
+	}
+	return eb.readLines(rd, wordc, dimen)
+}
+
+// ReadGloVe reads GloVe's text format, which has no header; the dimension is
+// taken from the first line.
+func (eb *Embeddings) ReadGloVe(istrm io.Reader) (err error) {
+	rd := bufio.NewReader(istrm)
+	head, err := rd.Peek(rd.Size())
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
 		return
 	}
+	line := strings.SplitN(string(head), "\n", 2)[0]
+	dimen := len(strings.Fields(line)) - 1
+	if dimen < 1 {
+		return fmt.Errorf("GloVe: no vectors in first line")
+	}
+	return eb.readLines(rd, 0, dimen)
+}
+
+// readLines reads "word x1 x2 ... xn" lines until EOF. Some vocabularies
+// contain words with spaces in them, so the last dimen fields are taken as
+// the vector and everything before them as the word.
+func (eb *Embeddings) readLines(rd *bufio.Reader, wordc, dimen int) (err error) {
 	eb.Dict = make(map[string]Vec, wordc)
+	eb.order = make([]string, 0, wordc)
 	eb.dim = dimen
-	for i := 0; i < wordc; i++ {
-		_, err = fmt.Fscanf(istrm, "%s", &t)
-		if err != nil {
-			if err == io.EOF {
-				err = nil
+	for lineno := 1; ; lineno++ {
+		var line string
+		line, err = rd.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return
+		}
+		eof := err == io.EOF
+		err = nil
+		fields := strings.Fields(line)
+		if len(fields) > dimen {
+			split := len(fields) - dimen
+			embedding := make(Vec, dimen)
+			for b, x := range fields[split:] {
+				var f float64
+				if f, err = strconv.ParseFloat(x, 32); err != nil {
+					return fmt.Errorf("line %d: %s", lineno, err)
+				}
+				embedding[b] = float32(f)
 			}
+			t := strings.Join(fields[:split], " ")
+			eb.Dict[t] = embedding
+			eb.order = append(eb.order, t)
+		} else if len(fields) > 0 {
+			return fmt.Errorf("line %d: %d fields, want %d", lineno, len(fields), dimen+1)
+		}
+		if eof {
 			return
 		}
-		embedding := make([]float32, dimen)
-		for b := 0; b < dimen; b++ {
-			_, err = fmt.Fscanf(istrm, "%f", &embedding[b])
-			if err != nil {
-				return
+	}
+}
+
+// Embedding file formats understood by Embeddings.Read.
+const (
+	FormatAuto  = "auto"
+	FormatBin   = "bin"
+	FormatTxt   = "txt"
+	FormatVec   = "vec"
+	FormatGloVe = "glove"
+)
+
+func header0(fields []string) string {
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+func floats(fields []string) bool {
+	for _, x := range fields {
+		if _, err := strconv.ParseFloat(x, 32); err != nil {
+			return false
+		}
+	}
+	return len(fields) > 0
+}
+
+// DetectFormat guesses the format of the embeddings rd is positioned at
+// without consuming anything. word2vec files start with a "count dimensions"
+// header, after which the binary format is told from the text one by whether
+// the first entry parses as text; GloVe has no header at all. A Store is
+// recognized by its magic.
+func DetectFormat(rd *bufio.Reader) (format string, err error) {
+	head, err := rd.Peek(rd.Size())
+	if err == io.EOF || err == bufio.ErrBufferFull {
+		err = nil
+	}
+	if err != nil {
+		return
+	}
+	if strings.HasPrefix(string(head), storeMagic[:len(storeMagic)-1]) {
+		format = FormatStore
+		return
+	}
+	lines := strings.SplitN(string(head), "\n", 3)
+	header := strings.Fields(lines[0])
+	if _, cerr := strconv.Atoi(header0(header)); len(header) == 2 && cerr == nil {
+		dimen, derr := strconv.Atoi(header[1])
+		if derr != nil {
+			err = fmt.Errorf("malformed header %q", lines[0])
+			return
+		}
+		format = FormatBin
+		if len(lines) == 3 {
+			// a complete second line in text form
+			if fields := strings.Fields(lines[1]); len(fields) > dimen && floats(fields[len(fields)-dimen:]) {
+				format = FormatTxt
 			}
 		}
+		return
 	}
+	if len(header) > 1 && floats(header[1:]) {
+		format = FormatGloVe
+		return
+	}
+	err = fmt.Errorf("embedding format not recognized")
 	return
 }
 
+// Read loads embeddings in the given format, detecting it if format is
+// FormatAuto or empty.
+func (eb *Embeddings) Read(istrm io.Reader, format string) (err error) {
+	rd := bufio.NewReaderSize(istrm, 1<<16)
+	if format == "" || format == FormatAuto {
+		if format, err = DetectFormat(rd); err != nil {
+			return
+		}
+	}
+	switch format {
+	case FormatBin:
+		return eb.ReadBin(rd)
+	case FormatTxt, FormatVec:
+		return eb.EmbedTxt(rd)
+	case FormatGloVe:
+		return eb.ReadGloVe(rd)
+	case FormatStore:
+		return fmt.Errorf("embedding stores are opened with OpenStore")
+	}
+	return fmt.Errorf("embedding format %q not recognized", format)
+}
+
+// ALaCarte averages the vectors of the tokens it is fed, each weighed by
+// Weights, which may be nil.
 type ALaCarte struct {
 	Vocab
 	Lexer
 	Oneshot
+	Weights *Weights
 }
 
 func (eb *ALaCarte) Advance(t string) (p bool) {
-	eb.Oneshot.Add(eb.Embed(t))
+	eb.Oneshot.Weigh(eb.Embed(t), eb.Weights.Weight(t))
 	return eb.Lexer.Advance(t)
 }
 
 func (eb *ALaCarte) Finalize() (x Vec) {
-	x = eb.Oneshot.Finalize()
-	eb.Oneshot = Oneshot{}
+	x = eb.Weights.Project(eb.Oneshot.Finalize())
+	eb.Oneshot.Reset()
 	return
 }
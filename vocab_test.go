@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// writeBin writes vocab in the binary word2vec format, with or without the
+// newline some writers put after each vector.
+func writeBin(vocab map[string]Vec, dim int, newlines bool) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d %d\n", len(vocab), dim)
+	for t, v := range vocab {
+		sb.WriteString(t + " ")
+		binary.Write(&sb, binary.LittleEndian, v)
+		if newlines {
+			sb.WriteByte('\n')
+		}
+	}
+	return sb.String()
+}
+
+func TestReadBin(t *testing.T) {
+	want := map[string]Vec{
+		"foo":   {1.5, 2.5},
+		"bar":   {-1, 0.25},
+		"hello": {32, 10},
+	}
+	for _, newlines := range []bool{false, true} {
+		for _, format := range []string{FormatBin, FormatAuto} {
+			var eb Embeddings
+			if err := eb.Read(strings.NewReader(writeBin(want, 2, newlines)), format); err != nil {
+				t.Fatalf("newlines=%v format=%s: %s", newlines, format, err)
+			}
+			if eb.Dim() != 2 || eb.Len() != len(want) {
+				t.Fatalf("newlines=%v format=%s: read %d words of %d dimensions",
+					newlines, format, eb.Len(), eb.Dim())
+			}
+			for w, v := range want {
+				got := eb.Embed(w)
+				if got == nil || got[0] != v[0] || got[1] != v[1] {
+					t.Errorf("newlines=%v format=%s: %q = %v, want %v", newlines, format, w, got, v)
+				}
+			}
+		}
+	}
+}
+
+// TestWords checks that words are listed in the order the file gave them,
+// which for word2vec is most frequent first, and that listing can stop early.
+func TestWords(t *testing.T) {
+	var eb Embeddings
+	src := "4 2\nthe 1 0\nof 0 1\nzebra 1 1\nand 0.5 0.5\n"
+	if err := eb.Read(strings.NewReader(src), FormatTxt); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	eb.Words(func(t string) bool {
+		got = append(got, t)
+		return len(got) < 3
+	})
+	if strings.Join(got, " ") != "the of zebra" {
+		t.Errorf("Words listed %q", got)
+	}
+}
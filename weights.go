@@ -0,0 +1,271 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	"gonum.org/v1/gonum/blas/blas32"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Scheme names a way of weighing the words ALaCarte averages.
+type Scheme string
+
+const (
+	// Uniform gives every word with a vector the same weight.
+	Uniform Scheme = "uniform"
+	// TFIDF weighs each occurrence of a word by its smoothed inverse
+	// document frequency, lenses being the documents.
+	TFIDF Scheme = "tfidf"
+	// SIF weighs each occurrence of a word by a/(a+p), p being the word's
+	// share of all the tokens in the index.
+	SIF Scheme = "sif"
+)
+
+func (scheme Scheme) Valid() error {
+	switch scheme {
+	case Uniform, TFIDF, SIF:
+		return nil
+	}
+	return fmt.Errorf("weighting scheme %q not recognized", string(scheme))
+}
+
+// Weighting configures Weights. A is the smoothing of SIF, 1e-3 if zero.
+// RemovePC subtracts from every vector its projection onto the first
+// principal component of the lens vectors, which the words common to all
+// of them pull towards. Pooling and Normalize configure the Oneshot the
+// weighed vectors are pooled with.
+type Weighting struct {
+	Scheme    Scheme
+	A         float64
+	RemovePC  bool
+	Pooling   Pooling
+	Normalize bool
+}
+
+// Weights are the word weights and common component shared by the document
+// and query vectors of an Index. They are tabulated from its lexical index by
+// Index.Reweigh, until which every word weighs the same; a nil *Weights is
+// Uniform.
+type Weights struct {
+	Weighting
+	// PC is the unit first principal component, nil unless RemovePC is set
+	// and the index has been reweighed.
+	PC     Vec
+	table  map[string]float32
+	unseen float32
+	sync.RWMutex
+}
+
+// Weight returns the weight of a single occurrence of t.
+func (weights *Weights) Weight(t string) float32 {
+	if weights == nil {
+		return 1
+	}
+	weights.RLock()
+	defer weights.RUnlock()
+	if weights.table == nil {
+		return 1
+	}
+	if w, ok := weights.table[t]; ok {
+		return w
+	}
+	return weights.unseen
+}
+
+// pool returns an empty Oneshot configured to pool weighed vectors.
+func (weights *Weights) pool() Oneshot {
+	if weights == nil {
+		return Oneshot{}
+	}
+	return Oneshot{Pooling: weights.Pooling, Normalize: weights.Normalize}
+}
+
+// Project removes the common component from v in place, scaling what is left
+// back to unit length if Normalize is set.
+func (weights *Weights) Project(v Vec) Vec {
+	if weights == nil || v == nil {
+		return v
+	}
+	weights.RLock()
+	defer weights.RUnlock()
+	if weights.PC == nil {
+		return v
+	}
+	dot := float32(0)
+	for i := range v {
+		dot += v[i] * weights.PC[i]
+	}
+	for i := range v {
+		v[i] -= dot * weights.PC[i]
+	}
+	if n := blas32.Nrm2(v.ToBlas()); weights.Normalize && n > 0 {
+		blas32.Scal(1/n, v.ToBlas())
+	}
+	return v
+}
+
+// tabulate computes the weight of every term counter has seen.
+func (weights *Weights) tabulate(counter *TfIdf) {
+	a := weights.A
+	if a <= 0 {
+		a = 1e-3
+	}
+	n := float64(counter.docs)
+	weight := func(tf, df int) float64 {
+		switch weights.Scheme {
+		case TFIDF:
+			return math.Log((1+n)/(1+float64(df))) + 1
+		case SIF:
+			if counter.count == 0 {
+				return 1
+			}
+			return a / (a + float64(tf)/float64(counter.count))
+		}
+		return 1
+	}
+	table := make(map[string]float32, len(counter.tf))
+	for t, tf := range counter.tf {
+		table[t] = float32(weight(tf, counter.df[t]))
+	}
+	weights.Lock()
+	weights.table, weights.unseen = table, float32(weight(0, 0))
+	weights.Unlock()
+}
+
+// principal returns the first principal component of vecs, uncentered as in
+// SIF, found by power iteration; nil if they are all zero.
+func principal(vecs []Vec, dim int) Vec {
+	cov := mat.NewSymDense(dim, nil)
+	x := mat.NewVecDense(dim, nil)
+	for _, v := range vecs {
+		if v == nil {
+			continue
+		}
+		for i := range v {
+			x.SetVec(i, float64(v[i]))
+		}
+		cov.SymRankOne(cov, 1, x)
+	}
+	u, w := mat.NewVecDense(dim, nil), mat.NewVecDense(dim, nil)
+	for i := 0; i < dim; i++ {
+		u.SetVec(i, 1/math.Sqrt(float64(dim)))
+	}
+	for iter := 0; iter < 100; iter++ {
+		w.MulVec(cov, u)
+		norm := mat.Norm(w, 2)
+		if norm == 0 {
+			return nil
+		}
+		w.ScaleVec(1/norm, w)
+		u.SubVec(u, w)
+		delta := mat.Norm(u, 2)
+		u, w = w, u
+		if delta < 1e-6 {
+			break
+		}
+	}
+	pc := make(Vec, dim)
+	for i := range pc {
+		pc[i] = float32(u.AtVec(i))
+	}
+	return pc
+}
+
+// Reweigh tabulates the weights from the lexical index, which by then
+// counts the whole corpus, embeds every lens and message again with them,
+// and, if RemovePC is set, removes their common component before rebuilding
+// the graph. Lenses added before are weighed uniformly, those added after
+// with the weights as they were at the last call. Uniform weights without
+// RemovePC have nothing to redo but the lenses that mention words the OOV
+// layer induced since they were embedded.
+func (index *Index) Reweigh() {
+	index.Lock()
+	defer index.Unlock()
+	if w := index.Weights; w == nil || w.Scheme == Uniform && !w.RemovePC {
+		index.reembedFresh()
+		return
+	}
+	index.reweigh()
+}
+
+func (index *Index) reweigh() {
+	if index.OOV != nil {
+		index.OOV.Fresh()
+	}
+	weights := index.Weights
+	weights.tabulate(&index.lexicon.TfIdf)
+	weights.Lock()
+	weights.PC = nil
+	weights.Unlock()
+	index.reembed(nil)
+	if weights.RemovePC && len(index.qledger) > 0 {
+		vecs := make([]Vec, 0, len(index.qledger))
+		for _, lens := range index.qledger {
+			vecs = append(vecs, lens.Vec)
+		}
+		pc := principal(vecs, index.Dim())
+		weights.Lock()
+		weights.PC = pc
+		weights.Unlock()
+		for _, lens := range index.qledger {
+			weights.Project(lens.Vec)
+			for _, msg := range lens.Messages {
+				weights.Project(msg.Vec)
+			}
+		}
+	}
+	index.rebuild()
+}
+
+// reembedFresh embeds again the lenses that mention words induced since
+// they were embedded.
+func (index *Index) reembedFresh() {
+	if index.OOV == nil {
+		return
+	}
+	if fresh := index.OOV.Fresh(); len(fresh) > 0 && index.reembed(fresh) > 0 {
+		index.rebuild()
+	}
+}
+
+// reembed embeds again the lenses whose messages mention any of words, or
+// every lens if words is nil, and returns how many it did.
+func (index *Index) reembed(words map[string]struct{}) (n int) {
+	prism := Prism{Vocab: index.Vocab, Weights: index.Weights}
+	for _, lens := range index.qledger {
+		if words != nil && !lens.mentions(words) {
+			continue
+		}
+		for i, msg := range lens.Messages {
+			lens.Messages[i].Vec, _ = sample(index.Vocab, index.Weights, msg.Content)
+		}
+		lens.Vec = prism.embed(lens.Messages, lens.KeyWords)
+		n++
+	}
+	return
+}
+
+func (lens *Lens) mentions(words map[string]struct{}) bool {
+	for _, msg := range lens.Messages {
+		for _, t := range tokens(msg.Content) {
+			if _, ok := words[t]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rebuild builds the graph again from the lens vectors.
+func (index *Index) rebuild() {
+	if index.cluster == nil {
+		return
+	}
+	index.cluster = index.Graph.withDefaults().build(index.Dim())
+	index.cluster.Grow(index.ledgerc)
+	for id := uint32(1); id <= uint32(len(index.qledger)); id++ {
+		index.cluster.Add(unit(index.qledger[id].Vec), id)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// yakeWindow is the number of words either side of a term that count as its
+// context.
+const yakeWindow = 2
+
+// YAKE scores words by the statistical features of Campos et al.: casing,
+// position, normalized frequency, dispersion of context and spread across
+// sentences, and phrases by combining those of their words with how often
+// the phrase itself occurs. YAKE scores are better the lower they are, so
+// their reciprocals are returned as weights.
+type YAKE struct {
+	passage
+}
+
+type yakeTerm struct {
+	tf, upper, acronym float64
+	sents              []int
+	left, right        map[string]int
+}
+
+func (ye *YAKE) Finalize() (tokens, phrases []ScoredPhrase) {
+	terms := make(map[string]*yakeTerm)
+	for i, sent := range ye.Sentences {
+		words := make([]word, 0, len(sent))
+		for _, w := range sent {
+			if w.Text != "" {
+				words = append(words, w)
+			}
+		}
+		for j, w := range words {
+			if w.stop() {
+				continue
+			}
+			term := terms[w.Text]
+			if term == nil {
+				term = &yakeTerm{left: make(map[string]int), right: make(map[string]int)}
+				terms[w.Text] = term
+			}
+			term.tf++
+			term.sents = append(term.sents, i)
+			runes := []rune(w.Raw)
+			if len(runes) > 1 && strings.ToUpper(w.Raw) == w.Raw && strings.ToLower(w.Raw) != w.Raw {
+				term.acronym++
+			} else if j > 0 && unicode.IsUpper(runes[0]) {
+				term.upper++
+			}
+			for k := 1; k <= yakeWindow; k++ {
+				if j-k >= 0 {
+					term.left[words[j-k].Text]++
+				}
+				if j+k < len(words) {
+					term.right[words[j+k].Text]++
+				}
+			}
+		}
+	}
+	if len(terms) == 0 {
+		return
+	}
+	var mean, std, maxTF float64
+	for _, term := range terms {
+		mean += term.tf
+		maxTF = math.Max(maxTF, term.tf)
+	}
+	mean /= float64(len(terms))
+	for _, term := range terms {
+		std += (term.tf - mean) * (term.tf - mean)
+	}
+	std = math.Sqrt(std / float64(len(terms)))
+	dispersion := func(ctx map[string]int) float64 {
+		total := 0
+		for _, n := range ctx {
+			total += n
+		}
+		if total == 0 {
+			return 0
+		}
+		return float64(len(ctx)) / float64(total)
+	}
+	scores := make(map[string]float64, len(terms))
+	for t, term := range terms {
+		casing := math.Max(term.upper, term.acronym) / (1 + math.Log(term.tf))
+		sents := append([]int(nil), term.sents...)
+		sort.Ints(sents)
+		position := math.Log(math.Log(3 + float64(sents[len(sents)/2])))
+		freq := term.tf / (mean + std)
+		relatedness := 1 + (dispersion(term.left)+dispersion(term.right))*term.tf/maxTF
+		distinct := 1
+		for k := 1; k < len(sents); k++ {
+			if sents[k] != sents[k-1] {
+				distinct++
+			}
+		}
+		spread := float64(distinct) / float64(len(ye.Sentences))
+		scores[t] = relatedness * position / (casing + freq/relatedness + spread/relatedness)
+	}
+	counts, seen := make(Counter), make(map[string][]string)
+	ye.candidates(func(_ int, phrase []string) {
+		k := strings.Join(phrase, " ")
+		counts.Inc(k, 1)
+		seen[k] = phrase
+	})
+	pscores := make(map[string]float64, len(seen))
+	for k, phrase := range seen {
+		prod, sum := 1.0, 0.0
+		for _, t := range phrase {
+			prod *= scores[t]
+			sum += scores[t]
+		}
+		pscores[k] = counts[k] * (1 + sum) / prod
+	}
+	words := make(map[string][]string, len(scores))
+	for t, score := range scores {
+		scores[t], words[t] = 1/score, []string{t}
+	}
+	return ranked(scores, words), ranked(pscores, seen)
+}